@@ -0,0 +1,746 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+// Package agentsim provides an embeddable SNMP agent for testing.
+//
+// The Agent answers Get, GetNext, GetBulk and Set requests (v1, v2c and v3)
+// from an in-memory OID tree. Counters can be stepped each time the agent
+// clock is advanced or incremented (and wrapped) on demand, the device can
+// be rebooted, and responses can be delayed or dropped to simulate slow or
+// unreachable devices. Each v3 context can have its own OID tree.
+package agentsim
+
+import (
+	"crypto/rand"
+	"log"
+	"net"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	// SysUpTime is served from the agent clock unless explicitly set
+	SysUpTime = ".1.3.6.1.2.1.1.3.0"
+
+	// default GetBulk max-repetitions, for when the request has none
+	defaultRepetitions = 10
+
+	usmStatsUnsupportedSecLevels = ".1.3.6.1.6.3.15.1.1.1.0"
+	usmStatsUnknownUserNames     = ".1.3.6.1.6.3.15.1.1.3.0"
+	usmStatsUnknownEngineIDs     = ".1.3.6.1.6.3.15.1.1.4.0"
+)
+
+type entry struct {
+	oid  []int
+	pdu  gosnmp.SnmpPDU
+	step uint64 // added to counters when the clock is advanced
+	ro   bool   // cannot be set by a request
+}
+
+// Agent is a simulated SNMP agent
+type Agent struct {
+	Community string                        // v1/v2c community, any is accepted if empty
+	V3        *gosnmp.UsmSecurityParameters // v3 user, v3 is disabled if nil, see SetV3
+	EngineID  string                        // v3 authoritative engine ID
+
+	mu       sync.Mutex
+	entries  []entry
+	uptime   bool // serve sysUpTime from the clock
+	boot     time.Time
+	offset   time.Duration
+	boots    uint32
+	delay    time.Duration
+	drop     int
+	fail     int
+	requests int
+	contexts map[string]*Agent
+	conn     *net.UDPConn
+	wg       sync.WaitGroup
+}
+
+// New returns an Agent with an empty OID tree other than sysUpTime
+func New() *Agent {
+	a := &Agent{
+		EngineID: "\x80\x00\x1f\x88\x04agentsim",
+		uptime:   true,
+		boot:     time.Now(),
+		boots:    1,
+	}
+	a.entries = []entry{{oid: octets(SysUpTime), pdu: gosnmp.SnmpPDU{Name: SysUpTime, Type: gosnmp.TimeTicks}, ro: true}}
+	return a
+}
+
+// octets converts a dotted OID to its sub-identifiers
+func octets(oid string) []int {
+	bits := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	words := make([]int, 0, len(bits))
+	for _, b := range bits {
+		i, _ := strconv.Atoi(b)
+		words = append(words, i)
+	}
+	return words
+}
+
+// less returns true if OID a sorts before OID b
+func less(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// normalize converts value to the Go type gosnmp marshals for kind
+func normalize(kind gosnmp.Asn1BER, value interface{}) (interface{}, error) {
+	var u uint64
+	var i int64
+	signed := false
+	switch v := value.(type) {
+	case int:
+		i, signed = int64(v), true
+	case int32:
+		i, signed = int64(v), true
+	case int64:
+		i, signed = v, true
+	case uint:
+		u = uint64(v)
+	case uint32:
+		u = uint64(v)
+	case uint64:
+		u = v
+	case string:
+		switch kind {
+		case gosnmp.OctetString, gosnmp.Opaque:
+			return []byte(v), nil
+		case gosnmp.ObjectIdentifier:
+			return "." + strings.TrimPrefix(v, "."), nil
+		case gosnmp.IPAddress:
+			return v, nil
+		}
+		return nil, errors.Errorf("invalid string value for %s", kind)
+	case []byte:
+		if kind == gosnmp.OctetString || kind == gosnmp.Opaque {
+			return v, nil
+		}
+		return nil, errors.Errorf("invalid bytes value for %s", kind)
+	case nil:
+		switch kind {
+		case gosnmp.Null, gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView:
+			return nil, nil
+		}
+		return nil, errors.Errorf("invalid nil value for %s", kind)
+	default:
+		return nil, errors.Errorf("unsupported value type %T", value)
+	}
+	if signed {
+		if kind == gosnmp.Integer {
+			return int(i), nil
+		}
+		if i < 0 {
+			return nil, errors.Errorf("negative value for %s", kind)
+		}
+		u = uint64(i)
+	}
+	switch kind {
+	case gosnmp.Integer:
+		return int(u), nil
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks:
+		return uint32(u), nil
+	case gosnmp.Counter64:
+		return u, nil
+	}
+	return nil, errors.Errorf("invalid numeric value for %s", kind)
+}
+
+// find returns the index of oid, or where it would be inserted
+func (a *Agent) find(oid []int) (int, bool) {
+	i := sort.Search(len(a.entries), func(i int) bool {
+		return !less(a.entries[i].oid, oid)
+	})
+	return i, i < len(a.entries) && !less(oid, a.entries[i].oid)
+}
+
+// Set adds or replaces the value of the OID.
+// Setting sysUpTime stops it from following the agent clock.
+func (a *Agent) Set(oid string, kind gosnmp.Asn1BER, value interface{}) error {
+	v, err := normalize(kind, value)
+	if err != nil {
+		return errors.Wrap(err, oid)
+	}
+	oid = "." + strings.TrimPrefix(oid, ".")
+	pdu := gosnmp.SnmpPDU{Name: oid, Type: kind, Value: v}
+	ints := octets(oid)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if oid == SysUpTime {
+		a.uptime = false
+	}
+	i, ok := a.find(ints)
+	if ok {
+		a.entries[i].pdu = pdu
+		return nil
+	}
+	a.entries = append(a.entries, entry{})
+	copy(a.entries[i+1:], a.entries[i:])
+	a.entries[i] = entry{oid: ints, pdu: pdu}
+	return nil
+}
+
+// ReadOnly causes set requests for the OID to fail as not writable
+func (a *Agent) ReadOnly(oid string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i, ok := a.find(octets(oid))
+	if !ok {
+		return errors.Errorf("no such OID: %s", oid)
+	}
+	a.entries[i].ro = true
+	return nil
+}
+
+// Get returns the current value of the OID
+func (a *Agent) Get(oid string) (gosnmp.SnmpPDU, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i, ok := a.find(octets(oid))
+	if !ok {
+		return gosnmp.SnmpPDU{}, false
+	}
+	return a.value(i), true
+}
+
+// Delete removes the OID
+func (a *Agent) Delete(oid string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if i, ok := a.find(octets(oid)); ok {
+		a.entries = append(a.entries[:i], a.entries[i+1:]...)
+	}
+}
+
+// Load adds the PDUs from an snmprec file
+func (a *Agent) Load(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pdus, err := ReadRecords(f)
+	if err != nil {
+		return errors.Wrap(err, filename)
+	}
+	for _, pdu := range pdus {
+		if err := a.Set(pdu.Name, pdu.Type, pdu.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add increments a counter or gauge, wrapping at its maximum value
+func add(pdu *gosnmp.SnmpPDU, delta uint64) error {
+	switch v := pdu.Value.(type) {
+	case uint32:
+		pdu.Value = uint32(uint64(v) + delta)
+	case uint64:
+		pdu.Value = v + delta
+	default:
+		return errors.Errorf("%s is not a counter", pdu.Name)
+	}
+	return nil
+}
+
+// Increment adds delta to the counter, wrapping at its maximum value
+func (a *Agent) Increment(oid string, delta uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i, ok := a.find(octets(oid))
+	if !ok {
+		return errors.Errorf("no such OID: %s", oid)
+	}
+	return add(&a.entries[i].pdu, delta)
+}
+
+// Step adds delta to the counter each time the agent clock is advanced,
+// so that polls between calls to Advance see it increase by delta
+func (a *Agent) Step(oid string, delta uint64) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	i, ok := a.find(octets(oid))
+	if !ok {
+		return errors.Errorf("no such OID: %s", oid)
+	}
+	switch a.entries[i].pdu.Value.(type) {
+	case uint32, uint64:
+	default:
+		return errors.Errorf("%s is not a counter", oid)
+	}
+	a.entries[i].step = delta
+	return nil
+}
+
+// Uptime returns the time since the agent was (re)booted
+func (a *Agent) Uptime() time.Duration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.elapsed()
+}
+
+func (a *Agent) elapsed() time.Duration {
+	return time.Since(a.boot) + a.offset
+}
+
+// Advance moves the agent clock forward, stepping any stepped counters
+func (a *Agent) Advance(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.offset += d
+	for i, e := range a.entries {
+		if e.step > 0 {
+			add(&a.entries[i].pdu, e.step)
+		}
+	}
+}
+
+// Reboot simulates a device restart: uptime starts over,
+// counters are reset to zero and the v3 engine boots is incremented
+func (a *Agent) Reboot() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.boot = time.Now()
+	a.offset = 0
+	a.boots++
+	for i, e := range a.entries {
+		switch e.pdu.Type {
+		case gosnmp.Counter32:
+			a.entries[i].pdu.Value = uint32(0)
+		case gosnmp.Counter64:
+			a.entries[i].pdu.Value = uint64(0)
+		case gosnmp.TimeTicks:
+			if e.pdu.Name == SysUpTime {
+				a.entries[i].pdu.Value = uint32(0)
+			}
+		}
+	}
+}
+
+// Delay causes each response to be sent after waiting d
+func (a *Agent) Delay(d time.Duration) {
+	a.mu.Lock()
+	a.delay = d
+	a.mu.Unlock()
+}
+
+// Drop ignores the next n requests, causing clients to time out.
+// All requests are ignored if n is negative.
+func (a *Agent) Drop(n int) {
+	a.mu.Lock()
+	a.drop = n
+	a.mu.Unlock()
+}
+
+// Fail answers the next n requests with a genErr.
+// All requests fail if n is negative.
+func (a *Agent) Fail(n int) {
+	a.mu.Lock()
+	a.fail = n
+	a.mu.Unlock()
+}
+
+// Requests returns the number of requests answered
+func (a *Agent) Requests() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests
+}
+
+// value returns the pdu at index i, the lock must be held
+func (a *Agent) value(i int) gosnmp.SnmpPDU {
+	pdu := a.entries[i].pdu
+	if a.uptime && pdu.Name == SysUpTime {
+		pdu.Value = uint32(a.elapsed() / (10 * time.Millisecond))
+	}
+	return pdu
+}
+
+// Listen starts answering requests on the UDP address (e.g., "127.0.0.1:0")
+func (a *Agent) Listen(addr string) error {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", uaddr)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.conn = conn
+	a.mu.Unlock()
+	a.wg.Add(1)
+	go a.serve(conn)
+	return nil
+}
+
+// Addr returns the address the agent is listening on
+func (a *Agent) Addr() *net.UDPAddr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Port returns the port the agent is listening on
+func (a *Agent) Port() int {
+	if addr := a.Addr(); addr != nil {
+		return addr.Port
+	}
+	return 0
+}
+
+// Close stops the agent
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	conn := a.conn
+	a.conn = nil
+	a.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+	err := conn.Close()
+	a.wg.Wait()
+	return err
+}
+
+func (a *Agent) serve(conn *net.UDPConn) {
+	defer a.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		go a.handle(conn, msg, addr)
+	}
+}
+
+// handle answers a single request
+func (a *Agent) handle(conn *net.UDPConn, msg []byte, addr *net.UDPAddr) {
+	// the decoder is not robust against all malformed input
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("agentsim: panic handling request from %s: %v\n%s", addr, r, debug.Stack())
+		}
+	}()
+
+	a.mu.Lock()
+	if a.drop != 0 {
+		if a.drop > 0 {
+			a.drop--
+		}
+		a.mu.Unlock()
+		return
+	}
+	delay := a.delay
+	v3 := a.V3
+	a.mu.Unlock()
+
+	decoder := &gosnmp.GoSNMP{}
+	if v3 != nil {
+		// keys are localized to the engine ID found in the request
+		decoder.SecurityParameters = &gosnmp.UsmSecurityParameters{
+			UserName:                 v3.UserName,
+			AuthenticationProtocol:   v3.AuthenticationProtocol,
+			AuthenticationPassphrase: v3.AuthenticationPassphrase,
+			PrivacyProtocol:          v3.PrivacyProtocol,
+			PrivacyPassphrase:        v3.PrivacyPassphrase,
+		}
+	}
+	req, err := decoder.SnmpDecodePacket(msg)
+	if err != nil {
+		return
+	}
+
+	var resp *gosnmp.SnmpPacket
+	switch req.Version {
+	case gosnmp.Version3:
+		if resp = a.v3Response(req, v3); resp == nil {
+			return
+		}
+	default:
+		if len(a.Community) > 0 && req.Community != a.Community {
+			return
+		}
+		resp = a.respond(req)
+	}
+
+	b, err := resp.MarshalMsg()
+	if err != nil {
+		return
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+	conn.WriteToUDP(b, addr)
+}
+
+// SetV3 replaces the v3 user, disabling v3 if nil
+func (a *Agent) SetV3(v3 *gosnmp.UsmSecurityParameters) {
+	a.mu.Lock()
+	a.V3 = v3
+	a.mu.Unlock()
+}
+
+// Context returns the agent that serves the named v3 context,
+// creating it if need be. Requests for other contexts are served
+// from the agent's own OID tree.
+func (a *Agent) Context(name string) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(name) == 0 {
+		return a
+	}
+	if a.contexts == nil {
+		a.contexts = make(map[string]*Agent)
+	}
+	c, ok := a.contexts[name]
+	if !ok {
+		c = New()
+		a.contexts[name] = c
+	}
+	return c
+}
+
+// context returns the agent serving the context
+func (a *Agent) context(name string) *Agent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if c, ok := a.contexts[name]; ok {
+		return c
+	}
+	return a
+}
+
+// securityLevel returns the message flags required by the v3 user
+func securityLevel(v3 *gosnmp.UsmSecurityParameters) gosnmp.SnmpV3MsgFlags {
+	switch {
+	case v3.PrivacyProtocol > gosnmp.NoPriv:
+		return gosnmp.AuthPriv
+	case v3.AuthenticationProtocol > gosnmp.NoAuth:
+		return gosnmp.AuthNoPriv
+	}
+	return gosnmp.NoAuthNoPriv
+}
+
+// v3Response returns the response to a v3 request, or a report if
+// the request fails the user security model checks for the v3 user
+func (a *Agent) v3Response(req *gosnmp.SnmpPacket, v3 *gosnmp.UsmSecurityParameters) *gosnmp.SnmpPacket {
+	if v3 == nil {
+		return nil
+	}
+	params, ok := req.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+	if !ok {
+		return nil
+	}
+
+	a.mu.Lock()
+	boots, secs := a.boots, uint32(a.elapsed()/time.Second)
+	a.mu.Unlock()
+
+	report := func(oid string) *gosnmp.SnmpPacket {
+		return &gosnmp.SnmpPacket{
+			Version:       gosnmp.Version3,
+			MsgID:         req.MsgID,
+			MsgFlags:      gosnmp.NoAuthNoPriv,
+			SecurityModel: gosnmp.UserSecurityModel,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{
+				AuthoritativeEngineID:    a.EngineID,
+				AuthoritativeEngineBoots: boots,
+				AuthoritativeEngineTime:  secs,
+				UserName:                 params.UserName,
+			},
+			ContextEngineID: a.EngineID,
+			ContextName:     req.ContextName,
+			PDUType:         gosnmp.Report,
+			RequestID:       req.RequestID,
+			Variables:       []gosnmp.SnmpPDU{{Name: oid, Type: gosnmp.Counter32, Value: uint32(1)}},
+		}
+	}
+
+	level := req.MsgFlags & gosnmp.AuthPriv
+	switch {
+	case params.AuthoritativeEngineID != a.EngineID:
+		// discovery
+		return report(usmStatsUnknownEngineIDs)
+	case params.UserName != v3.UserName:
+		return report(usmStatsUnknownUserNames)
+	case level != securityLevel(v3):
+		return report(usmStatsUnsupportedSecLevels)
+	}
+
+	resp := a.context(req.ContextName).respond(req)
+	resp.MsgID = req.MsgID
+	resp.MsgFlags = level
+	resp.SecurityModel = gosnmp.UserSecurityModel
+	resp.ContextEngineID = req.ContextEngineID
+	resp.ContextName = req.ContextName
+
+	salt := make([]byte, 8)
+	rand.Read(salt)
+	resp.SecurityParameters = &gosnmp.UsmSecurityParameters{
+		AuthoritativeEngineID:    a.EngineID,
+		AuthoritativeEngineBoots: boots,
+		AuthoritativeEngineTime:  secs,
+		UserName:                 params.UserName,
+		AuthenticationProtocol:   v3.AuthenticationProtocol,
+		PrivacyProtocol:          v3.PrivacyProtocol,
+		SecretKey:                params.SecretKey,
+		PrivacyKey:               params.PrivacyKey,
+		PrivacyParameters:        salt,
+	}
+	return resp
+}
+
+// respond builds the response to a request
+func (a *Agent) respond(req *gosnmp.SnmpPacket) *gosnmp.SnmpPacket {
+	resp := &gosnmp.SnmpPacket{
+		Version:   req.Version,
+		Community: req.Community,
+		PDUType:   gosnmp.GetResponse,
+		RequestID: req.RequestID,
+	}
+	missing := func(i int, name string, kind gosnmp.Asn1BER) {
+		if req.Version == gosnmp.Version1 {
+			// v1 has no exceptions, only an error for the first failure
+			if resp.Error == gosnmp.NoError {
+				resp.Error = gosnmp.NoSuchName
+				resp.ErrorIndex = uint8(i + 1)
+			}
+			kind = gosnmp.Null
+		}
+		resp.Variables = append(resp.Variables, gosnmp.SnmpPDU{Name: name, Type: kind})
+	}
+	getNext := func(i int, name string) string {
+		oid := octets(name)
+		j := sort.Search(len(a.entries), func(j int) bool {
+			return less(oid, a.entries[j].oid)
+		})
+		if j < len(a.entries) {
+			pdu := a.value(j)
+			resp.Variables = append(resp.Variables, pdu)
+			return pdu.Name
+		}
+		missing(i, name, gosnmp.EndOfMibView)
+		return ""
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests++
+
+	if a.fail != 0 {
+		if a.fail > 0 {
+			a.fail--
+		}
+		resp.Error = gosnmp.GenErr
+		resp.ErrorIndex = 1
+		resp.Variables = req.Variables
+		return resp
+	}
+
+	switch req.PDUType {
+	case gosnmp.GetRequest:
+		for i, v := range req.Variables {
+			oid := octets(v.Name)
+			if j, ok := a.find(oid); ok {
+				resp.Variables = append(resp.Variables, a.value(j))
+				continue
+			}
+			missing(i, v.Name, gosnmp.NoSuchObject)
+		}
+	case gosnmp.GetNextRequest:
+		for i, v := range req.Variables {
+			getNext(i, v.Name)
+		}
+	case gosnmp.GetBulkRequest:
+		// some decoders drop max-repetitions, so use a sane default
+		reps := req.MaxRepetitions
+		if reps == 0 {
+			reps = defaultRepetitions
+		}
+		for i, v := range req.Variables {
+			if i < int(req.NonRepeaters) {
+				getNext(i, v.Name)
+				continue
+			}
+			name := v.Name
+			for r := uint32(0); r < reps && len(name) > 0; r++ {
+				name = getNext(i, name)
+			}
+		}
+	case gosnmp.SetRequest:
+		resp.Variables = req.Variables
+		resp.Error, resp.ErrorIndex = a.set(req)
+	default:
+		resp.Error = gosnmp.GenErr
+		resp.ErrorIndex = 1
+		resp.Variables = req.Variables
+	}
+	return resp
+}
+
+// set applies all of the varbinds of a set request or none of them,
+// returning the error and index of the first that cannot be applied.
+// Only existing, writable values of the same type can be set.
+func (a *Agent) set(req *gosnmp.SnmpPacket) (gosnmp.SNMPError, uint8) {
+	fail := func(i int, err gosnmp.SNMPError) (gosnmp.SNMPError, uint8) {
+		if req.Version == gosnmp.Version1 {
+			// v1 only has a subset of the error codes
+			switch err {
+			case gosnmp.NoCreation, gosnmp.NotWritable:
+				err = gosnmp.NoSuchName
+			case gosnmp.WrongType:
+				err = gosnmp.BadValue
+			}
+		}
+		return err, uint8(i + 1)
+	}
+	values := make([]interface{}, len(req.Variables))
+	index := make([]int, len(req.Variables))
+	for i, v := range req.Variables {
+		j, ok := a.find(octets(v.Name))
+		if !ok {
+			return fail(i, gosnmp.NoCreation)
+		}
+		e := a.entries[j]
+		if e.ro {
+			return fail(i, gosnmp.NotWritable)
+		}
+		if e.pdu.Type != v.Type {
+			return fail(i, gosnmp.WrongType)
+		}
+		value, err := normalize(v.Type, v.Value)
+		if err != nil {
+			return fail(i, gosnmp.WrongValue)
+		}
+		values[i], index[i] = value, j
+	}
+	for i, j := range index {
+		a.entries[j].pdu.Value = values[i]
+	}
+	return gosnmp.NoError, 0
+}
@@ -0,0 +1,347 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package agentsim
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	sysDescr   = ".1.3.6.1.2.1.1.1.0"
+	sysName    = ".1.3.6.1.2.1.1.5.0"
+	ifInOctets = ".1.3.6.1.2.1.2.2.1.10.1"
+	ifHCIn     = ".1.3.6.1.2.1.31.1.1.1.6.1"
+)
+
+func testAgent(t *testing.T) *Agent {
+	a := New()
+	a.Community = "public"
+	a.Set(sysDescr, gosnmp.OctetString, "simulated switch")
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Set(ifInOctets, gosnmp.Counter32, 100)
+	a.Set(ifHCIn, gosnmp.Counter64, uint64(math.MaxUint64))
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func testClient(t *testing.T, a *Agent, version gosnmp.SnmpVersion) *gosnmp.GoSNMP {
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(a.Port()),
+		Community: "public",
+		Version:   version,
+		Timeout:   time.Second,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAgentVersions(t *testing.T) {
+	a := testAgent(t)
+	defer a.Close()
+
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		client := testClient(t, a, version)
+		resp, err := client.Get([]string{sysName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v := string(resp.Variables[0].Value.([]byte)); v != "sw1" {
+			t.Errorf("v%s: expected sw1, got %q", version, v)
+		}
+
+		walk := client.BulkWalkAll
+		if version == gosnmp.Version1 {
+			walk = client.WalkAll
+		}
+		pdus, err := walk(".1.3.6.1.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pdus) != 5 {
+			t.Errorf("v%s: expected 5 pdus, got %d", version, len(pdus))
+		}
+
+		resp, err = client.Get([]string{".1.3.6.1.2.1.1.99.0"})
+		switch version {
+		case gosnmp.Version1:
+			if err == nil && resp.Error != gosnmp.NoSuchName {
+				t.Errorf("v1: expected noSuchName, got %v", resp.Error)
+			}
+		default:
+			if err != nil || resp.Variables[0].Type != gosnmp.NoSuchObject {
+				t.Errorf("v2c: expected noSuchObject, got %v (%v)", resp.Variables[0].Type, err)
+			}
+		}
+		client.Conn.Close()
+	}
+}
+
+func TestAgentV3(t *testing.T) {
+	a := testAgent(t)
+	defer a.Close()
+	a.SetV3(&gosnmp.UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   gosnmp.SHA,
+		AuthenticationPassphrase: "authpass",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass",
+	})
+
+	v3 := func(auth, priv string) error {
+		client := &gosnmp.GoSNMP{
+			Target:        "127.0.0.1",
+			Port:          uint16(a.Port()),
+			Version:       gosnmp.Version3,
+			Timeout:       250 * time.Millisecond,
+			SecurityModel: gosnmp.UserSecurityModel,
+			MsgFlags:      gosnmp.AuthPriv,
+			SecurityParameters: &gosnmp.UsmSecurityParameters{
+				UserName:                 "user",
+				AuthenticationProtocol:   gosnmp.SHA,
+				AuthenticationPassphrase: auth,
+				PrivacyProtocol:          gosnmp.AES,
+				PrivacyPassphrase:        priv,
+			},
+		}
+		if err := client.Connect(); err != nil {
+			return err
+		}
+		defer client.Conn.Close()
+		pdus, err := client.BulkWalkAll(".1.3.6.1.2.1.1")
+		if err == nil && len(pdus) != 3 {
+			t.Errorf("expected 3 pdus, got %d", len(pdus))
+		}
+		return err
+	}
+	if err := v3("authpass", "privpass"); err != nil {
+		t.Fatal(err)
+	}
+	if err := v3("wrongpass", "privpass"); err == nil {
+		t.Error("expected error for wrong auth passphrase")
+	}
+	if err := v3("authpass", "wrongpass"); err == nil {
+		t.Error("expected error for wrong privacy passphrase")
+	}
+}
+
+func TestAgentCounters(t *testing.T) {
+	a := testAgent(t)
+	defer a.Close()
+	client := testClient(t, a, gosnmp.Version2c)
+	defer client.Conn.Close()
+
+	get := func(oid string) interface{} {
+		resp, err := client.Get([]string{oid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Variables[0].Value
+	}
+
+	// 64 bit counters wrap to zero
+	if err := a.Increment(ifHCIn, 5); err != nil {
+		t.Fatal(err)
+	}
+	if v := get(ifHCIn); v != uint64(4) {
+		t.Errorf("expected wrapped counter of 4, got %v", v)
+	}
+
+	// each poll sees the stepped increase as the clock advances
+	if err := a.Step(ifInOctets, math.MaxUint32); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []uint{100, 99, 98} {
+		if v := get(ifInOctets); v != want {
+			t.Errorf("expected %d, got %v", want, v)
+		}
+		if v := get(ifInOctets); v != want {
+			t.Errorf("expected %d on repeated get, got %v", want, v)
+		}
+		a.Advance(time.Second)
+	}
+	if err := a.Step(sysName, 1); err == nil {
+		t.Error("expected error stepping a string")
+	}
+
+	// uptime and counters start over on reboot
+	a.Advance(time.Hour)
+	before := get(SysUpTime).(uint32)
+	if before < 360000 {
+		t.Errorf("expected uptime of at least an hour, got %d", before)
+	}
+	a.Reboot()
+	if after := get(SysUpTime).(uint32); after >= before {
+		t.Errorf("expected uptime to be reset, got %d", after)
+	}
+	if v := get(ifInOctets); v != uint(0) {
+		t.Errorf("expected counter to be reset, got %v", v)
+	}
+}
+
+func TestAgentStepTable(t *testing.T) {
+	const column = ".1.3.6.1.2.1.2.2.1.16"
+	a := testAgent(t)
+	defer a.Close()
+	for i := 1; i <= 3; i++ {
+		oid := column + "." + strconv.Itoa(i)
+		a.Set(oid, gosnmp.Counter32, 100*i)
+		a.Step(oid, 10)
+	}
+
+	// every row is stepped, whichever request of the walk reads it
+	for _, version := range []gosnmp.SnmpVersion{gosnmp.Version1, gosnmp.Version2c} {
+		client := testClient(t, a, version)
+		walk := func() []uint {
+			walker := client.BulkWalkAll
+			if version == gosnmp.Version1 {
+				walker = client.WalkAll
+			}
+			pdus, err := walker(column)
+			if err != nil {
+				t.Fatal(err)
+			}
+			values := []uint{}
+			for _, pdu := range pdus {
+				values = append(values, pdu.Value.(uint))
+			}
+			return values
+		}
+		before := walk()
+		a.Advance(time.Minute)
+		after := walk()
+		if len(before) != 3 || len(after) != 3 {
+			t.Fatalf("v%s expected 3 rows, got: %v %v", version, before, after)
+		}
+		for i := range before {
+			if after[i]-before[i] != 10 {
+				t.Errorf("v%s expected each row to step by 10, got: %v then %v", version, before, after)
+			}
+		}
+		client.Conn.Close()
+	}
+}
+
+func TestAgentFaults(t *testing.T) {
+	a := testAgent(t)
+	defer a.Close()
+	client := testClient(t, a, gosnmp.Version2c)
+	defer client.Conn.Close()
+	client.Timeout = 100 * time.Millisecond
+	client.Retries = 0
+
+	a.Drop(1)
+	if _, err := client.Get([]string{sysName}); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected timeout, got: %v", err)
+	}
+	if _, err := client.Get([]string{sysName}); err != nil {
+		t.Errorf("expected response after drop, got: %v", err)
+	}
+
+	a.Delay(50 * time.Millisecond)
+	start := time.Now()
+	if _, err := client.Get([]string{sysName}); err != nil {
+		t.Fatal(err)
+	}
+	if since := time.Since(start); since < 50*time.Millisecond {
+		t.Errorf("expected delayed response, got response in %s", since)
+	}
+	if n := a.Requests(); n != 2 {
+		t.Errorf("expected 2 requests answered, got %d", n)
+	}
+
+	// wrong community is ignored
+	client.Community = "private"
+	if _, err := client.Get([]string{sysName}); err == nil {
+		t.Error("expected timeout for wrong community")
+	}
+}
+
+func TestRecords(t *testing.T) {
+	in := `# comment
+1.3.6.1.2.1.1.1.0|4|simulated|switch
+1.3.6.1.2.1.1.3.0|67|42
+1.3.6.1.2.1.1.6.0|4x|00ff
+1.3.6.1.2.1.2.2.1.10.1|65|4294967295
+1.3.6.1.2.1.4.20.1.1.10.0.0.1|64|10.0.0.1
+`
+	pdus, err := ReadRecords(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pdus) != 5 {
+		t.Fatalf("expected 5 pdus, got %d", len(pdus))
+	}
+	if v := string(pdus[0].Value.([]byte)); v != "simulated|switch" {
+		t.Errorf("expected value with separator, got %q", v)
+	}
+	out := []string{}
+	for _, pdu := range pdus {
+		line, ok := FormatRecord(pdu)
+		if !ok {
+			t.Fatalf("unable to format %v", pdu)
+		}
+		out = append(out, line)
+	}
+	if got, want := strings.Join(out, "\n"), strings.TrimPrefix(strings.TrimSpace(in), "# comment\n"); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	if _, err := ParseRecord("1.3.6.1|99|x"); err == nil {
+		t.Error("expected error for unknown type")
+	}
+}
+
+func TestAgentSet(t *testing.T) {
+	a := testAgent(t)
+	defer a.Close()
+	a.ReadOnly(sysDescr)
+
+	client := testClient(t, a, gosnmp.Version2c)
+	defer client.Conn.Close()
+
+	resp, err := client.Set([]gosnmp.SnmpPDU{{Name: sysName, Type: gosnmp.OctetString, Value: []byte("sw2")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != gosnmp.NoError {
+		t.Fatalf("set failed: %v", resp.Error)
+	}
+	if pdu, _ := a.Get(sysName); string(pdu.Value.([]byte)) != "sw2" {
+		t.Errorf("expected sw2, got: %s", pdu.Value)
+	}
+
+	for _, test := range []struct {
+		pdu  gosnmp.SnmpPDU
+		want gosnmp.SNMPError
+	}{
+		{gosnmp.SnmpPDU{Name: sysDescr, Type: gosnmp.OctetString, Value: []byte("x")}, gosnmp.NotWritable},
+		{gosnmp.SnmpPDU{Name: sysName, Type: gosnmp.Integer, Value: 1}, gosnmp.WrongType},
+		{gosnmp.SnmpPDU{Name: ".1.3.6.1.2.1.1.6.0", Type: gosnmp.OctetString, Value: []byte("x")}, gosnmp.NoCreation},
+	} {
+		// a failure of any varbind means none are set
+		pdus := []gosnmp.SnmpPDU{{Name: sysName, Type: gosnmp.OctetString, Value: []byte("sw3")}, test.pdu}
+		resp, err := client.Set(pdus)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Error != test.want || resp.ErrorIndex != 2 {
+			t.Errorf("%s expected error %v at 2, got: %v at %d", test.pdu.Name, test.want, resp.Error, resp.ErrorIndex)
+		}
+		if pdu, _ := a.Get(sysName); string(pdu.Value.([]byte)) != "sw2" {
+			t.Errorf("expected sw2, got: %s", pdu.Value)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package agentsim
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+var (
+	// snmprec type tags
+	recTags = map[gosnmp.Asn1BER]string{
+		gosnmp.Integer:          "2",
+		gosnmp.OctetString:      "4",
+		gosnmp.Null:             "5",
+		gosnmp.ObjectIdentifier: "6",
+		gosnmp.IPAddress:        "64",
+		gosnmp.Counter32:        "65",
+		gosnmp.Gauge32:          "66",
+		gosnmp.TimeTicks:        "67",
+		gosnmp.Opaque:           "68",
+		gosnmp.Counter64:        "70",
+	}
+	recTypes = make(map[string]gosnmp.Asn1BER)
+)
+
+func init() {
+	for k, v := range recTags {
+		recTypes[v] = k
+	}
+}
+
+// FormatRecord formats the PDU as a line of an snmprec file
+// (OID|TYPE|VALUE), returning false if the type is not supported
+func FormatRecord(pdu gosnmp.SnmpPDU) (string, bool) {
+	tag, ok := recTags[pdu.Type]
+	if !ok {
+		return "", false
+	}
+	oid := strings.TrimPrefix(pdu.Name, ".")
+	value := ""
+	switch pdu.Type {
+	case gosnmp.OctetString, gosnmp.Opaque:
+		var b []byte
+		switch v := pdu.Value.(type) {
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		}
+		value = string(b)
+		for _, c := range b {
+			if c < ' ' || c > '~' {
+				tag += "x"
+				value = hex.EncodeToString(b)
+				break
+			}
+		}
+	case gosnmp.ObjectIdentifier:
+		value = strings.TrimPrefix(fmt.Sprint(pdu.Value), ".")
+	case gosnmp.Null:
+	default:
+		value = fmt.Sprint(pdu.Value)
+	}
+	return oid + "|" + tag + "|" + value, true
+}
+
+// ParseRecord parses a line of an snmprec file
+func ParseRecord(line string) (gosnmp.SnmpPDU, error) {
+	var pdu gosnmp.SnmpPDU
+	bits := strings.SplitN(line, "|", 3)
+	if len(bits) != 3 {
+		return pdu, errors.Errorf("invalid snmprec line: %q", line)
+	}
+	tag, value := bits[1], bits[2]
+	hexed := strings.HasSuffix(tag, "x")
+	kind, ok := recTypes[strings.TrimSuffix(tag, "x")]
+	if !ok {
+		return pdu, errors.Errorf("unsupported snmprec type: %s", tag)
+	}
+	pdu.Name = "." + strings.TrimPrefix(bits[0], ".")
+	pdu.Type = kind
+
+	if hexed {
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return pdu, errors.Wrapf(err, "invalid hex value for %s", pdu.Name)
+		}
+		value = string(b)
+	}
+	var err error
+	switch kind {
+	case gosnmp.Integer:
+		pdu.Value, err = strconv.Atoi(value)
+	case gosnmp.OctetString, gosnmp.Opaque:
+		pdu.Value = []byte(value)
+	case gosnmp.ObjectIdentifier:
+		pdu.Value = "." + strings.TrimPrefix(value, ".")
+	case gosnmp.IPAddress:
+		pdu.Value = value
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks:
+		var u uint64
+		u, err = strconv.ParseUint(value, 10, 32)
+		pdu.Value = uint32(u)
+	case gosnmp.Counter64:
+		pdu.Value, err = strconv.ParseUint(value, 10, 64)
+	}
+	return pdu, errors.Wrapf(err, "invalid value for %s", pdu.Name)
+}
+
+// ReadRecords reads PDUs from snmprec formatted data.
+// Blank lines and lines starting with '#' are ignored.
+func ReadRecords(r io.Reader) ([]gosnmp.SnmpPDU, error) {
+	pdus := []gosnmp.SnmpPDU{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pdu, err := ParseRecord(line)
+		if err != nil {
+			return nil, err
+		}
+		pdus = append(pdus, pdu)
+	}
+	return pdus, s.Err()
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DropPolicy determines what an AsyncSender does when its queue is full
+type DropPolicy int
+
+const (
+	// Block waits for room in the queue
+	Block DropPolicy = iota
+	// DropOldest discards the oldest queued value to make room
+	DropOldest
+	// DropNewest discards the value being sent
+	DropNewest
+)
+
+// AsyncStats are the counts of values handled by an AsyncSender
+type AsyncStats struct {
+	Enqueued  uint64 // values queued
+	Delivered uint64 // values sent without error
+	Failed    uint64 // values sent that returned an error
+	Dropped   uint64 // values discarded because the queue was full
+}
+
+// queued is a value waiting to be sent
+type queued struct {
+	name  string
+	tags  map[string]string
+	value interface{}
+	ts    TimeStamp
+}
+
+// AsyncQueue delivers the values queued by an AsyncSender
+type AsyncQueue struct {
+	sender Sender
+	policy DropPolicy
+	queue  chan queued
+
+	closing sync.RWMutex // held for reading while queueing
+	closed  bool
+	done    chan struct{}
+
+	mu      sync.Mutex
+	idle    *sync.Cond // signalled when nothing is pending
+	pending int
+	err     error // last delivery error
+	stats   AsyncStats
+}
+
+// AsyncSender returns a Sender that queues values for delivery to sender
+// in the background, so that polling is not slowed by the sender. When the
+// queue is full values are handled per the policy. Errors from sender are
+// counted rather than returned. The AsyncQueue should be closed when done
+// to deliver any remaining values.
+func AsyncSender(sender Sender, queueSize int, policy DropPolicy) (Sender, *AsyncQueue) {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	q := &AsyncQueue{
+		sender: sender,
+		policy: policy,
+		queue:  make(chan queued, queueSize),
+		done:   make(chan struct{}),
+	}
+	q.idle = sync.NewCond(&q.mu)
+	go q.deliver()
+	return q.send, q
+}
+
+// deliver sends queued values until the queue is closed
+func (q *AsyncQueue) deliver() {
+	defer close(q.done)
+	for v := range q.queue {
+		err := q.sender(v.name, v.tags, v.value, v.ts)
+		q.mu.Lock()
+		if err != nil {
+			q.stats.Failed++
+			q.err = err
+		} else {
+			q.stats.Delivered++
+		}
+		q.release(1)
+		q.mu.Unlock()
+	}
+}
+
+// release notes that n values are no longer pending, the lock must be held
+func (q *AsyncQueue) release(n int) {
+	q.pending -= n
+	if q.pending == 0 {
+		q.idle.Broadcast()
+	}
+}
+
+// send queues the value per the drop policy
+func (q *AsyncQueue) send(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+	q.closing.RLock()
+	defer q.closing.RUnlock()
+	if q.closed {
+		return errors.New("async sender is closed")
+	}
+	v := queued{name, tags, value, ts}
+
+	q.mu.Lock()
+	q.pending++
+	q.stats.Enqueued++
+	q.mu.Unlock()
+
+	switch q.policy {
+	case DropNewest:
+		select {
+		case q.queue <- v:
+		default:
+			q.mu.Lock()
+			q.stats.Dropped++
+			q.release(1)
+			q.mu.Unlock()
+		}
+	case DropOldest:
+		for {
+			select {
+			case q.queue <- v:
+				return nil
+			default:
+			}
+			select {
+			case <-q.queue:
+				q.mu.Lock()
+				q.stats.Dropped++
+				q.release(1)
+				q.mu.Unlock()
+			default:
+			}
+		}
+	default:
+		q.queue <- v
+	}
+	return nil
+}
+
+// Flush waits until all queued values have been delivered (or dropped)
+// and returns the last delivery error, if any
+func (q *AsyncQueue) Flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.pending > 0 {
+		q.idle.Wait()
+	}
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// Close stops queueing, delivers any remaining values and returns
+// the last delivery error, if any. It is safe to call more than once.
+func (q *AsyncQueue) Close() error {
+	q.closing.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.closing.Unlock()
+	<-q.done
+	return q.Flush()
+}
+
+// Stats returns the counts of values handled so far
+func (q *AsyncQueue) Stats() AsyncStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
@@ -0,0 +1,97 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAsyncSender(t *testing.T) {
+	for policy, want := range map[DropPolicy]string{
+		Block:      "[0 1 2 3 4]",
+		DropOldest: "[0 3 4]",
+		DropNewest: "[0 1 2]",
+	} {
+		var mu sync.Mutex
+		var got []interface{}
+		gate := make(chan struct{})
+		sink := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+			<-gate
+			mu.Lock()
+			got = append(got, value)
+			mu.Unlock()
+			return nil
+		}
+		sender, q := AsyncSender(sink, 2, policy)
+
+		// the first value is held by the sink, so the queue then fills
+		sender("v", nil, 0, TimeStamp{})
+		time.Sleep(10 * time.Millisecond)
+		sent := make(chan struct{})
+		go func() {
+			for i := 1; i < 5; i++ {
+				sender("v", nil, i, TimeStamp{})
+			}
+			close(sent)
+		}()
+		if policy == Block {
+			select {
+			case <-sent:
+				t.Error("expected a full queue to block")
+			case <-time.After(10 * time.Millisecond):
+			}
+			close(gate)
+			<-sent
+		} else {
+			<-sent
+			close(gate)
+		}
+		if err := q.Close(); err != nil {
+			t.Error(err)
+		}
+		if fmt.Sprint(got) != want {
+			t.Errorf("policy %d expected %s, got: %v", policy, want, got)
+		}
+		stats := q.Stats()
+		if stats.Enqueued != 5 || stats.Delivered+stats.Dropped != 5 {
+			t.Errorf("policy %d unexpected stats: %+v", policy, stats)
+		}
+		if err := sender("v", nil, 5, TimeStamp{}); err == nil {
+			t.Errorf("policy %d expected error sending after close", policy)
+		}
+	}
+}
+
+func TestAsyncFlush(t *testing.T) {
+	count := 0
+	sink := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		time.Sleep(time.Millisecond)
+		count++
+		if value == 3 {
+			return fmt.Errorf("bad value: %v", value)
+		}
+		return nil
+	}
+	sender, q := AsyncSender(sink, 10, Block)
+	defer q.Close()
+	for i := 0; i < 5; i++ {
+		sender("v", nil, i, TimeStamp{})
+	}
+	if err := q.Flush(); err == nil {
+		t.Error("expected delivery error")
+	}
+	if count != 5 {
+		t.Errorf("expected 5 values delivered, got: %d", count)
+	}
+	if stats := q.Stats(); stats.Delivered != 4 || stats.Failed != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if err := q.Flush(); err != nil {
+		t.Errorf("expected error to be cleared, got: %v", err)
+	}
+}
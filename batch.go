@@ -0,0 +1,176 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sample is a single value as passed to a Sender
+type Sample struct {
+	Name      string
+	Tags      map[string]string
+	Value     interface{}
+	TimeStamp TimeStamp
+}
+
+// BatchSender sends many samples at once, for backends that are
+// more efficient with bulk writes
+type BatchSender func([]Sample) error
+
+// defaultIdle is how long a walk must be quiet to be taken as complete
+const defaultIdle = time.Second
+
+// Batcher collects samples for a BatchSender
+type Batcher struct {
+	sender BatchSender
+	size   int
+	idle   time.Duration
+	mu     sync.Mutex
+	walks  map[TimeStamp]*walkBatch
+	err    error // from sending in the background
+	once   sync.Once
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// walkBatch holds the pending samples of a walk
+type walkBatch struct {
+	samples []Sample
+	last    time.Time // when a sample was last added
+}
+
+// BatchingSender returns a Sender that collects samples and passes them
+// to sender in batches. All values of a walk share a TimeStamp, so samples
+// are batched by TimeStamp, and walks of many devices can share a Batcher.
+//
+// Senders are not told when a walk ends, so a walk is taken to be complete
+// once none of its samples have arrived for idle (a second, if zero), and
+// its batch is then sent. A walk that pauses for longer than idle, as for
+// a slow device or a retried request, is split across batches, so idle
+// should be longer than the client timeout if that matters. A batch is
+// also sent whenever size samples of the walk are pending (if size is
+// non-zero). Errors sending in the background are returned by the next
+// Flush or Close. The Batcher should be closed when done to send any
+// remaining samples.
+func BatchingSender(sender BatchSender, size int, idle time.Duration) (Sender, *Batcher) {
+	if idle <= 0 {
+		idle = defaultIdle
+	}
+	b := &Batcher{
+		sender: sender,
+		size:   size,
+		idle:   idle,
+		walks:  make(map[TimeStamp]*walkBatch),
+		done:   make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		t := time.NewTicker(idle / 2)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				if err := b.flush(now.Add(-idle)); err != nil {
+					b.mu.Lock()
+					if b.err == nil {
+						b.err = err
+					}
+					b.mu.Unlock()
+				}
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return b.add, b
+}
+
+// add appends the sample to the batch of its walk, sending the batch
+// if it is full
+func (b *Batcher) add(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+	b.mu.Lock()
+	w, ok := b.walks[ts]
+	if !ok {
+		w = &walkBatch{}
+		b.walks[ts] = w
+	}
+	w.samples = append(w.samples, Sample{name, tags, value, ts})
+	w.last = time.Now()
+	if b.size == 0 || len(w.samples) < b.size {
+		b.mu.Unlock()
+		return nil
+	}
+	delete(b.walks, ts)
+	b.mu.Unlock()
+
+	// other walks are not held up while this one is sent
+	return b.sender(w.samples)
+}
+
+// flush sends the batches of walks that have had no samples since
+// the given time, in the order the walks started
+func (b *Batcher) flush(since time.Time) error {
+	b.mu.Lock()
+	ready := []*walkBatch{}
+	for ts, w := range b.walks {
+		if !w.last.After(since) {
+			ready = append(ready, w)
+			delete(b.walks, ts)
+		}
+	}
+	b.mu.Unlock()
+
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].samples[0].TimeStamp.Start.Before(ready[j].samples[0].TimeStamp.Start)
+	})
+	var err error
+	for _, w := range ready {
+		if e := b.sender(w.samples); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Flush sends all pending samples, returning the first error
+// encountered since the last Flush
+func (b *Batcher) Flush() error {
+	err := b.flush(time.Now())
+	b.mu.Lock()
+	if b.err != nil {
+		err = b.err
+	}
+	b.err = nil
+	b.mu.Unlock()
+	return err
+}
+
+// Close stops the Batcher and sends any pending samples
+func (b *Batcher) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+		b.wg.Wait()
+	})
+	return b.Flush()
+}
+
+// UnbatchSender returns a BatchSender that passes each sample to sender,
+// so that existing senders can be used where a BatchSender is expected.
+// The first error encountered is returned after all samples are sent.
+func UnbatchSender(sender Sender) BatchSender {
+	return func(samples []Sample) error {
+		var err error
+		for _, s := range samples {
+			if e := sender(s.Name, s.Tags, s.Value, s.TimeStamp); e != nil && err == nil {
+				err = e
+			}
+		}
+		return err
+	}
+}
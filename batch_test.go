@@ -0,0 +1,168 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatchingSender(t *testing.T) {
+	var batches []string
+	sink := func(samples []Sample) error {
+		var names []string
+		for _, s := range samples {
+			names = append(names, fmt.Sprintf("%s=%v", s.Name, s.Value))
+		}
+		batches = append(batches, fmt.Sprint(names))
+		return nil
+	}
+	sender, b := BatchingSender(sink, 3, time.Hour)
+
+	// interleaved walks are batched separately
+	now := time.Now()
+	first := TimeStamp{Start: now, Stop: now}
+	second := TimeStamp{Start: now.Add(time.Millisecond), Stop: now.Add(time.Millisecond)}
+	sender("a", nil, 1, first)
+	sender("x", nil, 2, second)
+	sender("b", nil, 3, first)
+	sender("y", nil, 4, second)
+	if len(batches) > 0 {
+		t.Errorf("expected no batches before size reached, got: %v", batches)
+	}
+	sender("c", nil, 5, first)
+	if want := "[[a=1 b=3 c=5]]"; fmt.Sprint(batches) != want {
+		t.Errorf("expected %s after batch size, got: %v", want, batches)
+	}
+	sender("d", nil, 6, first)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[[a=1 b=3 c=5] [d=6] [x=2 y=4]]"; fmt.Sprint(batches) != want {
+		t.Errorf("expected %s after close, got: %v", want, batches)
+	}
+	// must not panic
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchingIdle(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]Sample
+	sink := func(samples []Sample) error {
+		mu.Lock()
+		batches = append(batches, samples)
+		mu.Unlock()
+		return nil
+	}
+	sender, b := BatchingSender(sink, 0, 50*time.Millisecond)
+	defer b.Close()
+
+	// a walk is sent once it has gone quiet
+	ts := TimeStamp{Start: time.Now()}
+	for i := 0; i < 5; i++ {
+		sender("a", nil, i, ts)
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 1 || len(batches[0]) != 5 {
+		t.Errorf("expected the walk sent as one batch, got: %v", batches)
+	}
+}
+
+func TestBatchingErrors(t *testing.T) {
+	sink := func(samples []Sample) error {
+		return fmt.Errorf("backend down")
+	}
+	sender, b := BatchingSender(sink, 0, 10*time.Millisecond)
+	defer b.Close()
+
+	// failures sending in the background are not lost
+	sender("a", nil, 1, TimeStamp{Start: time.Now()})
+	time.Sleep(50 * time.Millisecond)
+	if err := b.Flush(); err == nil || err.Error() != "backend down" {
+		t.Errorf("expected background error, got: %v", err)
+	}
+	if err := b.Flush(); err != nil {
+		t.Errorf("expected error to be reported once, got: %v", err)
+	}
+}
+
+func TestBatchingSlowSink(t *testing.T) {
+	release := make(chan struct{})
+	sink := func(samples []Sample) error {
+		if samples[0].Name == "slow" {
+			<-release
+		}
+		return nil
+	}
+	sender, b := BatchingSender(sink, 2, time.Hour)
+	defer b.Close()
+	defer close(release)
+
+	// a slow send does not hold up other walks
+	now := time.Now()
+	slow := TimeStamp{Start: now}
+	go func() {
+		sender("slow", nil, 1, slow)
+		sender("slow", nil, 2, slow)
+	}()
+	added := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		sender("fast", nil, 1, TimeStamp{Start: now.Add(time.Millisecond)})
+		close(added)
+	}()
+	select {
+	case <-added:
+	case <-time.After(time.Second):
+		t.Error("sender blocked by another walk being sent")
+	}
+}
+
+func TestBatchingChain(t *testing.T) {
+	// existing senders compose on either side of a batch
+	var got []string
+	final := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		got = append(got, fmt.Sprintf("%s=%v %v", name, value, tags))
+		return nil
+	}
+	var sizes []int
+	unbatch := UnbatchSender(StripSender(final, []string{"oid"}))
+	sender, b := BatchingSender(func(samples []Sample) error {
+		sizes = append(sizes, len(samples))
+		return unbatch(samples)
+	}, 0, time.Hour)
+	sender, err := RegexpSender(sender, []string{"^ifIn"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender = CalcSender(sender, Recipies{"ifInOctets": {}})
+	start := time.Now()
+	for i, v := range []uint32{100, 150, 175} {
+		when := start.Add(time.Duration(i) * time.Minute)
+		ts := TimeStamp{Start: when, Stop: when}
+		sender("ifInOctets", map[string]string{"oid": ".1.3.6.1.2.1.2.2.1.10.1"}, v, ts)
+		sender("ifOutOctets", map[string]string{"oid": ".1.3.6.1.2.1.2.2.1.16.1"}, v, ts)
+	}
+	if len(got) > 0 {
+		t.Errorf("expected no data before flush, got: %v", got)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "[ifInOctets=50 map[] ifInOctets=25 map[]]"; fmt.Sprint(got) != want {
+		t.Errorf("expected %s, got: %v", want, got)
+	}
+	// the cooked samples of each walk after the first are a batch
+	if fmt.Sprint(sizes) != "[1 1]" {
+		t.Errorf("expected a batch per walk, got sizes: %v", sizes)
+	}
+}
@@ -5,7 +5,10 @@
 package snmputil
 
 import (
+	"encoding/hex"
 	"net"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,10 +25,65 @@ type Profile struct {
 	Port, Timeout, Retries   int
 	// for SNMP v3
 	SecLevel, AuthUser, AuthPass, AuthProto, PrivProto, PrivPass string
+	ContextName                                                  string // context to poll, e.g., "vlan-10"
+	ContextEngineID                                              string // in hex, defaults to the agent's engine ID
 }
 
-// newClient returns an snmp client that has connected to an snmp agent
+// newClient returns an snmp client that has connected to an snmp agent,
+// or to a replay of a recorded walk if the Host is a "file://" path
 func newClient(p Profile) (*gosnmp.GoSNMP, error) {
+	if strings.HasPrefix(p.Host, replayScheme) {
+		return replayClient(p)
+	}
+	_, err := net.LookupHost(p.Host)
+	if err != nil {
+		return nil, err
+	}
+	client, err := clientConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	return client, client.Connect()
+}
+
+// protoNames returns a sorted list of protocol names
+func protoNames(names []string) string {
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// contextConfig validates and applies the v3 context of the Profile
+func contextConfig(client *gosnmp.GoSNMP, p Profile) error {
+	if err := validContext(p.ContextName); err != nil {
+		return errors.Wrapf(err, "host %s", p.Host)
+	}
+	client.ContextName = p.ContextName
+	if len(p.ContextEngineID) == 0 {
+		return nil
+	}
+	id, err := hex.DecodeString(strings.TrimPrefix(strings.Replace(p.ContextEngineID, ":", "", -1), "0x"))
+	if err != nil {
+		return errors.Errorf("invalid context engine ID %s for host %s", p.ContextEngineID, p.Host)
+	}
+	// per RFC 3411 engine IDs are 5 to 32 octets
+	if len(id) < 5 || len(id) > 32 {
+		return errors.Errorf("context engine ID %s for host %s must be 5 to 32 octets", p.ContextEngineID, p.Host)
+	}
+	client.ContextEngineID = string(id)
+	return nil
+}
+
+// validContext returns an error if the context name is not valid
+func validContext(name string) error {
+	// per RFC 3411 context names are at most 32 octets
+	if len(name) > 32 {
+		return errors.Errorf("context name %q is longer than 32 octets", name)
+	}
+	return nil
+}
+
+// clientConfig returns an unconnected snmp client configured per the Profile
+func clientConfig(p Profile) (*gosnmp.GoSNMP, error) {
 	var ok bool
 	var aProto gosnmp.SnmpV3AuthProtocol
 	var pProto gosnmp.SnmpV3PrivProtocol
@@ -35,11 +93,20 @@ func newClient(p Profile) (*gosnmp.GoSNMP, error) {
 		"NoAuth": gosnmp.NoAuth,
 		"MD5":    gosnmp.MD5,
 		"SHA":    gosnmp.SHA,
+		"SHA224": gosnmp.SHA224,
+		"SHA256": gosnmp.SHA256,
+		"SHA384": gosnmp.SHA384,
+		"SHA512": gosnmp.SHA512,
 	}
+	// the "C" variants use the Cisco (Reeder) key extension
 	privacy := map[string]gosnmp.SnmpV3PrivProtocol{
-		"NoPriv": gosnmp.NoPriv,
-		"DES":    gosnmp.DES,
-		"AES":    gosnmp.AES,
+		"NoPriv":  gosnmp.NoPriv,
+		"DES":     gosnmp.DES,
+		"AES":     gosnmp.AES,
+		"AES192":  gosnmp.AES192,
+		"AES256":  gosnmp.AES256,
+		"AES192C": gosnmp.AES192C,
+		"AES256C": gosnmp.AES256C,
 	}
 
 	authCheck := func() error {
@@ -47,7 +114,11 @@ func newClient(p Profile) (*gosnmp.GoSNMP, error) {
 			return errors.Errorf("no SNMPv3 password for host %s", p.Host)
 		}
 		if aProto, ok = authProto[p.AuthProto]; !ok {
-			return errors.Errorf("invalid auth protocol %s for host %s", p.AuthProto, p.Host)
+			names := make([]string, 0, len(authProto))
+			for name := range authProto {
+				names = append(names, name)
+			}
+			return errors.Errorf("invalid auth protocol %s for host %s (supported: %s)", p.AuthProto, p.Host, protoNames(names))
 		}
 		return nil
 	}
@@ -80,7 +151,11 @@ func newClient(p Profile) (*gosnmp.GoSNMP, error) {
 			}
 
 			if pProto, ok = privacy[p.PrivProto]; !ok {
-				return nil, errors.Errorf("invalid in Privcy Protocol %s for host %s", p.PrivProto, p.Host)
+				names := make([]string, 0, len(privacy))
+				for name := range privacy {
+					names = append(names, name)
+				}
+				return nil, errors.Errorf("invalid privacy protocol %s for host %s (supported: %s)", p.PrivProto, p.Host, protoNames(names))
 			}
 
 			return &gosnmp.UsmSecurityParameters{
@@ -96,11 +171,6 @@ func newClient(p Profile) (*gosnmp.GoSNMP, error) {
 		}
 	}
 
-	_, err := net.LookupHost(p.Host)
-	if err != nil {
-		return nil, err
-	}
-
 	if p.Port == 0 {
 		p.Port = defaultPort
 	}
@@ -128,13 +198,19 @@ func newClient(p Profile) (*gosnmp.GoSNMP, error) {
 		client.SecurityModel = gosnmp.UserSecurityModel
 		client.SecurityParameters = usmParams
 		client.Version = gosnmp.Version3
+		if err := contextConfig(client, p); err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.New("invalid snmp version")
 	}
+	if client.Version != gosnmp.Version3 && len(p.ContextName)+len(p.ContextEngineID) > 0 {
+		return nil, errors.Errorf("context requires snmp v3 for host %s", p.Host)
+	}
 
 	if snmpLogger != nil {
 		client.Logger = snmpLogger
 	}
 
-	return client, client.Connect()
+	return client, nil
 }
@@ -8,14 +8,15 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/paulstuart/snmputil/agentsim"
 	"github.com/pkg/errors"
 	"github.com/soniah/gosnmp"
 )
 
 const (
-	sysName = ".1.3.6.1.2.1.1.5.0"
 	oidFile = "oids.json"
 	mibs    = "SNMPv2-MIB:IF-MIB"
 )
@@ -135,3 +136,56 @@ func TestV3Profile(t *testing.T) {
 	}
 	client.Conn.Close()
 }
+
+func TestV3Protocols(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	p := Profile{
+		Host:      "127.0.0.1",
+		Port:      a.Port(),
+		Version:   "3",
+		Timeout:   testTimeout,
+		SecLevel:  "AuthPriv",
+		AuthUser:  "user",
+		AuthPass:  "authpass",
+		AuthProto: "SHA512",
+		PrivPass:  "privpass",
+		PrivProto: "AES256C",
+	}
+	auths := map[string]gosnmp.SnmpV3AuthProtocol{"SHA256": gosnmp.SHA256, "SHA512": gosnmp.SHA512}
+	privs := map[string]gosnmp.SnmpV3PrivProtocol{"AES192": gosnmp.AES192, "AES256": gosnmp.AES256, "AES256C": gosnmp.AES256C}
+	for authName, auth := range auths {
+		for privName, priv := range privs {
+			a.SetV3(&gosnmp.UsmSecurityParameters{
+				UserName:                 "user",
+				AuthenticationProtocol:   auth,
+				AuthenticationPassphrase: "authpass",
+				PrivacyProtocol:          priv,
+				PrivacyPassphrase:        "privpass",
+			})
+			p.AuthProto, p.PrivProto = authName, privName
+			client, err := newClient(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := testSysName(client); err != nil {
+				t.Errorf("%s/%s: %v", authName, privName, err)
+			}
+			client.Conn.Close()
+		}
+	}
+
+	p.AuthProto = "SHA1024"
+	if _, err := clientConfig(p); err == nil || !strings.Contains(err.Error(), "SHA256") {
+		t.Errorf("expected error listing supported auth protocols, got: %v", err)
+	}
+	p.AuthProto, p.PrivProto = "SHA", "AES512"
+	if _, err := clientConfig(p); err == nil || !strings.Contains(err.Error(), "AES256C") {
+		t.Errorf("expected error listing supported privacy protocols, got: %v", err)
+	}
+}
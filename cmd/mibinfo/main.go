@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
 
 	"github.com/paulstuart/snmputil"
 )
@@ -10,12 +11,17 @@ import (
 var (
 	mibs string
 	name string
+	dirs string
 )
 
 func main() {
 	flag.StringVar(&mibs, "m", mibs, "mibs to reference")
 	flag.StringVar(&name, "f", name, "filename to save to")
+	flag.StringVar(&dirs, "M", dirs, "directories to search for mibs (colon separated)")
 	flag.Parse()
+	if len(dirs) > 0 {
+		snmputil.MibDirs = filepath.SplitList(dirs)
+	}
 	// mib := "JUNIPER-IF-MIB:NS-ROOT-MIB"
 	if len(name) > 0 {
 		f, err := os.Create(name)
@@ -0,0 +1,109 @@
+// snmppoll polls the devices described by a JSON config file,
+// reloading the config on SIGHUP
+//
+// e.g., snmppoll -c snmppoll.json -m SNMPv2-MIB:IF-MIB
+//
+// An example config:
+//
+//	{
+//		"Credentials": {
+//			"lab": {"Community": "public", "Version": "2c", "Timeout": 5}
+//		},
+//		"Criteria": {
+//			"traffic": {"OIDs": ["ifHCInOctets", "ifHCOutOctets"], "Freq": 60, "Refresh": 3600},
+//			"system": {"OIDs": ["sysUpTime.0"], "Get": true, "Freq": 300}
+//		},
+//		"Outputs": {
+//			"influx": {
+//				"Recipes": {"ifHCInOctets": {"Rate": true}, "ifHCOutOctets": {"Rate": true}},
+//				"Strip": ["oid"],
+//				"Influx": "http://localhost:8086/write?db=snmp",
+//				"Batch": 1000,
+//				"Interval": 10
+//			}
+//		},
+//		"Devices": [
+//			{"Host": "sw1", "Credentials": "lab", "Criteria": ["traffic", "system"], "Output": "influx"}
+//		]
+//	}
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/paulstuart/snmputil"
+)
+
+var (
+	configFile = "snmppoll.json"
+	mibs       string
+	mibFile    = "oids.json"
+	verbose    bool
+)
+
+func main() {
+	flag.StringVar(&configFile, "c", configFile, "config file")
+	flag.StringVar(&mibs, "m", mibs, "mibs to load (colon separated)")
+	flag.StringVar(&mibFile, "f", mibFile, "file to cache mib data in")
+	flag.BoolVar(&verbose, "v", verbose, "verbose logging")
+	flag.Parse()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	if len(mibs) > 0 {
+		if err := snmputil.LoadMIBs(mibFile, mibs); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	cfg, err := snmputil.LoadConfig(configFile)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	var errFn snmputil.ErrFunc
+	if verbose {
+		errFn = func(err error) {
+			if err != nil {
+				logger.Println(err)
+			}
+		}
+	}
+	sched := snmputil.NewScheduler(cfg.Workers, time.Duration(cfg.Jitter)*time.Second, errFn, logger)
+	poller := snmputil.NewConfigPoller(sched, logger)
+	if err := poller.Apply(cfg); err != nil {
+		logger.Println(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig != syscall.SIGHUP {
+				cancel()
+				return
+			}
+			// workers and jitter are only read on startup
+			cfg, err := snmputil.LoadConfig(configFile)
+			if err != nil {
+				logger.Println(err)
+				continue
+			}
+			if err := poller.Apply(cfg); err != nil {
+				logger.Println(err)
+			}
+			logger.Printf("reloaded %s\n", configFile)
+		}
+	}()
+
+	sched.Run(ctx)
+	if err := poller.Close(); err != nil {
+		logger.Println(err)
+	}
+}
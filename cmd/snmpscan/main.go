@@ -0,0 +1,182 @@
+// snmpscan sweeps address ranges for SNMP devices and reports
+// the settings that work for each, along with their identity.
+// Communities and passphrases are not reported.
+//
+// e.g., snmpscan -c public,private -f csv 10.0.0.0/24 10.0.1.0/24
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/paulstuart/snmputil"
+)
+
+var (
+	communities = "public"
+	versions    = "2c"
+	port        = 161
+	timeout     = 1
+	retries     = 0
+	workers     = 64
+	format      = "json"
+
+	secLevel  string
+	authUser  string
+	authProto = "SHA"
+	authPass  string
+	privProto = "AES"
+	privPass  string
+)
+
+// device is the profile and identity of a device that was found,
+// without any secrets
+type device struct {
+	Host        string
+	Port        int
+	Version     string
+	SecLevel    string `json:",omitempty"`
+	AuthUser    string `json:",omitempty"`
+	AuthProto   string `json:",omitempty"`
+	PrivProto   string `json:",omitempty"`
+	SysName     string
+	SysDescr    string
+	SysObjectID string
+	SysLocation string
+	SysUpTime   int64 // seconds
+}
+
+var csvHeader = []string{
+	"Host", "Port", "Version", "SecLevel", "AuthUser", "AuthProto", "PrivProto",
+	"SysName", "SysDescr", "SysObjectID", "SysLocation", "SysUpTime",
+}
+
+func (d device) csv() []string {
+	return []string{
+		d.Host, strconv.Itoa(d.Port), d.Version, d.SecLevel, d.AuthUser, d.AuthProto, d.PrivProto,
+		d.SysName, d.SysDescr, d.SysObjectID, d.SysLocation, strconv.FormatInt(d.SysUpTime, 10),
+	}
+}
+
+// candidates returns the profiles to try for each version
+func candidates() []snmputil.Profile {
+	profiles := []snmputil.Profile{}
+	for _, version := range strings.Split(versions, ",") {
+		switch version {
+		case "3":
+			level := secLevel
+			if len(level) == 0 {
+				switch {
+				case len(privPass) > 0:
+					level = "AuthPriv"
+				case len(authPass) > 0:
+					level = "AuthNoPriv"
+				default:
+					level = "NoAuthNoPriv"
+				}
+			}
+			profiles = append(profiles, snmputil.Profile{
+				Version:   version,
+				Port:      port,
+				SecLevel:  level,
+				AuthUser:  authUser,
+				AuthProto: authProto,
+				AuthPass:  authPass,
+				PrivProto: privProto,
+				PrivPass:  privPass,
+			})
+		default:
+			for _, community := range strings.Split(communities, ",") {
+				profiles = append(profiles, snmputil.Profile{
+					Version:   version,
+					Port:      port,
+					Community: community,
+				})
+			}
+		}
+	}
+	return profiles
+}
+
+func main() {
+	flag.StringVar(&communities, "c", communities, "communities to try (comma separated)")
+	flag.StringVar(&versions, "v", versions, "versions to try, in order (comma separated, e.g. 3,2c)")
+	flag.IntVar(&port, "p", port, "agent port")
+	flag.IntVar(&timeout, "t", timeout, "timeout in seconds for each probe")
+	flag.IntVar(&retries, "r", retries, "retries for each probe")
+	flag.IntVar(&workers, "w", workers, "number of concurrent probes")
+	flag.StringVar(&format, "f", format, "output format (json or csv)")
+	flag.StringVar(&secLevel, "l", secLevel, "v3 security level (NoAuthNoPriv, AuthNoPriv or AuthPriv)")
+	flag.StringVar(&authUser, "u", authUser, "v3 user")
+	flag.StringVar(&authProto, "a", authProto, "v3 auth protocol")
+	flag.StringVar(&authPass, "A", authPass, "v3 auth passphrase")
+	flag.StringVar(&privProto, "x", privProto, "v3 privacy protocol")
+	flag.StringVar(&privPass, "X", privPass, "v3 privacy passphrase")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: snmpscan [options] cidr|host ...")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	var out func(device)
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		out = func(d device) {
+			enc.Encode(d)
+		}
+	case "csv":
+		w := csv.NewWriter(os.Stdout)
+		w.Write(csvHeader)
+		defer w.Flush()
+		out = func(d device) {
+			w.Write(d.csv())
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "invalid format:", format)
+		os.Exit(1)
+	}
+
+	s := snmputil.Scanner{
+		Discoverer: snmputil.Discoverer{
+			Order:   strings.Split(versions, ","),
+			Timeout: timeout,
+			Retries: retries,
+		},
+		Workers: workers,
+	}
+	err := s.Scan(flag.Args(), candidates(), func(p snmputil.Profile, id snmputil.Identity) {
+		d := device{
+			Host:        p.Host,
+			Port:        p.Port,
+			Version:     p.Version,
+			SysName:     id.Name,
+			SysDescr:    id.Descr,
+			SysObjectID: id.ObjectID,
+			SysLocation: id.Location,
+			SysUpTime:   int64(id.Uptime.Seconds()),
+		}
+		if p.Version == "3" {
+			d.SecLevel = p.SecLevel
+			d.AuthUser = p.AuthUser
+			if p.SecLevel != "NoAuthNoPriv" {
+				d.AuthProto = p.AuthProto
+			}
+			if p.SecLevel == "AuthPriv" {
+				d.PrivProto = p.PrivProto
+			}
+		}
+		out(d)
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
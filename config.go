@@ -0,0 +1,322 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Config describes the devices to poll and where to send their data
+type Config struct {
+	Workers     int                     // concurrent polls (default is the number of CPUs)
+	Jitter      int                     // seconds over which to spread the first polls
+	Credentials map[string]Profile      // credential sets by name (Host is not used)
+	Criteria    map[string]Criteria     // criteria by name
+	Outputs     map[string]OutputConfig // output chains by name
+	Devices     []DeviceConfig          // devices to poll
+}
+
+// DeviceConfig describes a device to poll
+type DeviceConfig struct {
+	Host        string            // name or address of the device
+	Credentials string            // name of the credential set to use
+	Criteria    []string          // names of the criteria to poll
+	Output      string            // name of the output chain for the data
+	Tags        map[string]string // any additional tags to associate
+}
+
+// OutputConfig describes a chain of senders. Data passes through
+// each configured step in the order of the fields below.
+type OutputConfig struct {
+	Recipes     Recipies // counter calculations (sets OIDTag on criteria)
+	Regexps     []string // regular expressions to filter by name
+	Keep        bool     // Keep matched names if true, discard matches if false
+	Strip       []string // tags to remove
+	Integer     bool     // convert unsigned values to signed integers
+	Debug       bool     // log data to stdout
+	Influx      string   // InfluxDB write url, e.g., http://localhost:8086/write?db=snmp
+	Measurement string   // InfluxDB measurement (default is "snmp")
+	Batch       int      // lines per InfluxDB post
+	Interval    int      // seconds between InfluxDB posts
+}
+
+// ReadConfig decodes a JSON config
+func ReadConfig(r io.Reader) (*Config, error) {
+	var c Config
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, errors.Wrap(err, "invalid config")
+	}
+	return &c, c.validate()
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ReadConfig(f)
+	return c, errors.Wrap(err, filename)
+}
+
+// validate checks that all references are to things defined
+func (c *Config) validate() error {
+	for i, d := range c.Devices {
+		if len(d.Host) == 0 {
+			return errors.Errorf("device %d has no host", i+1)
+		}
+		if _, ok := c.Credentials[d.Credentials]; !ok {
+			return errors.Errorf("device %s has unknown credentials: %q", d.Host, d.Credentials)
+		}
+		if _, ok := c.Outputs[d.Output]; !ok && len(d.Output) > 0 {
+			return errors.Errorf("device %s has unknown output: %q", d.Host, d.Output)
+		}
+		if len(d.Criteria) == 0 {
+			return errors.Errorf("device %s has no criteria", d.Host)
+		}
+		for _, name := range d.Criteria {
+			if _, ok := c.Criteria[name]; !ok {
+				return errors.Errorf("device %s has unknown criteria: %q", d.Host, name)
+			}
+		}
+	}
+	return nil
+}
+
+// configJob is a job scheduled per the config
+type configJob struct {
+	id   string // scheduler job id
+	spec string // the config the job was scheduled with
+}
+
+// configSink is the final sender of an output chain
+type configSink struct {
+	spec   string
+	sender Sender
+	close  func() error
+}
+
+// ConfigPoller schedules polling per a Config. When a new Config is
+// applied only the jobs whose configuration has changed are restarted.
+type ConfigPoller struct {
+	sched  *Scheduler
+	logger *log.Logger
+
+	mu    sync.Mutex
+	jobs  map[string]configJob  // by device/criteria
+	sinks map[string]configSink // by output name
+}
+
+// NewConfigPoller returns a ConfigPoller that schedules jobs on s
+func NewConfigPoller(s *Scheduler, logger *log.Logger) *ConfigPoller {
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	return &ConfigPoller{
+		sched:  s,
+		logger: logger,
+		jobs:   make(map[string]configJob),
+		sinks:  make(map[string]configSink),
+	}
+}
+
+// spec returns a fingerprint of the values for change detection
+func spec(values ...interface{}) string {
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+// sink returns the final sender for the output, which is shared
+// by all devices using the output
+func (c *ConfigPoller) sink(name string, out OutputConfig) (Sender, error) {
+	fp := spec(out.Debug, out.Influx, out.Measurement, out.Batch, out.Interval)
+	if s, ok := c.sinks[name]; ok {
+		if s.spec == fp {
+			return s.sender, nil
+		}
+		if err := s.close(); err != nil {
+			c.logger.Println(errors.Wrapf(err, "closing output %s", name))
+		}
+		delete(c.sinks, name)
+	}
+
+	s := configSink{spec: fp, close: func() error { return nil }}
+	if len(out.Influx) > 0 {
+		measurement := out.Measurement
+		if len(measurement) == 0 {
+			measurement = "snmp"
+		}
+		var w *InfluxWriter
+		s.sender, w = InfluxHTTPSender(out.Influx, measurement, out.Batch, time.Duration(out.Interval)*time.Second, InfluxOptions{})
+		s.close = w.Close
+	}
+	if out.Debug || s.sender == nil {
+		sender, err := DebugSender(s.sender, nil)
+		if err != nil {
+			return nil, err
+		}
+		s.sender = sender
+	}
+	c.sinks[name] = s
+	return s.sender, nil
+}
+
+// chain returns the sender chain for the output. Each job has its own
+// chain, as counter calculations are tracked by OID.
+func chain(sink Sender, out OutputConfig) (Sender, error) {
+	sender := sink
+	if out.Integer {
+		sender = IntegerSender(sender)
+	}
+	if len(out.Strip) > 0 {
+		sender = StripSender(sender, out.Strip)
+	}
+	if len(out.Regexps) > 0 {
+		var err error
+		if sender, err = RegexpSender(sender, out.Regexps, out.Keep); err != nil {
+			return nil, err
+		}
+	}
+	if len(out.Recipes) > 0 {
+		sender = CalcSender(sender, out.Recipes)
+	}
+	return sender, nil
+}
+
+// Apply schedules the jobs of the config, removing jobs no longer
+// configured and restarting those whose configuration has changed.
+// Jobs that cannot be scheduled are reported and retried on the next Apply.
+func (c *ConfigPoller) Apply(cfg *Config) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type want struct {
+		p    Profile
+		crit Criteria
+		out  string
+		spec string
+	}
+	wanted := make(map[string]want)
+	for _, d := range cfg.Devices {
+		p := cfg.Credentials[d.Credentials]
+		p.Host = d.Host
+		out := cfg.Outputs[d.Output]
+		for _, name := range d.Criteria {
+			crit := cfg.Criteria[name]
+			tags := make(map[string]string, len(crit.Tags)+len(d.Tags))
+			for k, v := range crit.Tags {
+				tags[k] = v
+			}
+			for k, v := range d.Tags {
+				tags[k] = v
+			}
+			crit.Tags = tags
+			if len(out.Recipes) > 0 {
+				crit.OIDTag = true
+			}
+			key := d.Host + "/" + name
+			wanted[key] = want{p, crit, d.Output, spec(p, crit, d.Output, out)}
+		}
+	}
+
+	// stop jobs that are gone or changed
+	for key, j := range c.jobs {
+		if w, ok := wanted[key]; ok && w.spec == j.spec {
+			continue
+		}
+		if err := c.sched.Remove(j.id); err != nil {
+			c.logger.Println(err)
+		}
+		delete(c.jobs, key)
+	}
+
+	// close outputs no longer used
+	for name, s := range c.sinks {
+		if _, ok := cfg.Outputs[name]; !ok {
+			if err := s.close(); err != nil {
+				c.logger.Println(errors.Wrapf(err, "closing output %s", name))
+			}
+			delete(c.sinks, name)
+		}
+	}
+
+	keys := make([]string, 0, len(wanted))
+	for key := range wanted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	failed := []string{}
+	for _, key := range keys {
+		if _, ok := c.jobs[key]; ok {
+			continue
+		}
+		w := wanted[key]
+		out := cfg.Outputs[w.out]
+		sink, err := c.sink(w.out, out)
+		if err != nil {
+			failed = append(failed, errors.Wrap(err, key).Error())
+			continue
+		}
+		sender, err := chain(sink, out)
+		if err != nil {
+			failed = append(failed, errors.Wrap(err, key).Error())
+			continue
+		}
+		id, err := c.sched.AddJob(key, w.p, w.crit, sender)
+		if err != nil {
+			failed = append(failed, errors.Wrap(err, key).Error())
+			continue
+		}
+		c.jobs[key] = configJob{id: id, spec: w.spec}
+	}
+	if len(failed) > 0 {
+		return errors.Errorf("jobs not scheduled: %s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Jobs returns the scheduler ids of the configured jobs, by device/criteria
+func (c *ConfigPoller) Jobs() map[string]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	jobs := make(map[string]string, len(c.jobs))
+	for key, j := range c.jobs {
+		jobs[key] = j.id
+	}
+	return jobs
+}
+
+// Close removes all jobs and closes the outputs
+func (c *ConfigPoller) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, j := range c.jobs {
+		c.sched.Remove(j.id)
+		delete(c.jobs, key)
+	}
+	var err error
+	for name, s := range c.sinks {
+		if e := s.close(); e != nil && err == nil {
+			err = errors.Wrapf(e, "closing output %s", name)
+		}
+		delete(c.sinks, name)
+	}
+	return err
+}
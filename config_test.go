@@ -0,0 +1,144 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+const testConfig = `{
+	"Credentials": {
+		"lab": {"Community": "public", "Version": "2c", "Port": %d, "Timeout": 1}
+	},
+	"Criteria": {
+		"sys": {"OIDs": ["sysName.0", "sysUpTime.0"], "Get": true, "Freq": 60},
+		"counts": {"OID": ".1.3.6.1.3.9995", "Freq": %d},
+		"often": {"OID": ".1.3.6.1.3.9995", "Freq": 10}
+	},
+	"Outputs": {
+		"influx": {"Strip": ["oid"], "Influx": "http://127.0.0.1:1/write?db=snmp"}
+	},
+	"Devices": [
+		{"Host": "127.0.0.1", "Credentials": "lab", "Criteria": [%s], "Output": "influx", "Tags": {"site": "lab"}}
+	]
+}`
+
+func TestConfigPoller(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Set(".1.3.6.1.3.9995.1.0", gosnmp.Counter32, 1)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	config := func(freq int, criteria string) *Config {
+		c, err := ReadConfig(strings.NewReader(fmt.Sprintf(testConfig, a.Port(), freq, criteria)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	s := NewScheduler(1, 0, nil, nil)
+	c := NewConfigPoller(s, nil)
+	defer c.Close()
+
+	jobs := func() map[string]JobInfo {
+		list := map[string]JobInfo{}
+		for _, j := range s.List() {
+			list[j.ID] = j
+		}
+		return list
+	}
+
+	if err := c.Apply(config(60, `"sys", "counts"`)); err != nil {
+		t.Fatal(err)
+	}
+	before := jobs()
+	if len(before) != 2 || len(c.Jobs()) != 2 {
+		t.Fatalf("expected 2 jobs, got: %v", before)
+	}
+
+	// only the changed criteria is restarted
+	time.Sleep(10 * time.Millisecond)
+	if err := c.Apply(config(120, `"sys", "counts"`)); err != nil {
+		t.Fatal(err)
+	}
+	after := jobs()
+	ids := c.Jobs()
+	sys, counts := ids["127.0.0.1/sys"], ids["127.0.0.1/counts"]
+	if !after[sys].Next.Equal(before[sys].Next) {
+		t.Error("unchanged job was restarted")
+	}
+	if after[counts].Freq != 120 || !after[counts].Next.After(before[counts].Next) {
+		t.Errorf("changed job was not restarted: %+v", after[counts])
+	}
+
+	// removed criteria are stopped
+	if err := c.Apply(config(120, `"sys"`)); err != nil {
+		t.Fatal(err)
+	}
+	if after = jobs(); len(after) != 1 || !after[sys].Next.Equal(before[sys].Next) {
+		t.Errorf("expected only the unchanged sys job, got: %v", after)
+	}
+
+	// criteria with the same OIDs are separate jobs
+	if err := c.Apply(config(120, `"sys", "counts", "often"`)); err != nil {
+		t.Fatal(err)
+	}
+	if after = jobs(); len(after) != 3 {
+		t.Errorf("expected 3 jobs, got: %v", after)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, cfg := range []string{
+		`{"Devices": [{"Host": "sw1", "Credentials": "none", "Criteria": ["sys"]}]}`,
+		`{"Credentials": {"lab": {}}, "Devices": [{"Host": "sw1", "Credentials": "lab", "Criteria": ["none"]}]}`,
+		`{"Credentials": {"lab": {}}, "Criteria": {"sys": {}}, "Devices": [{"Host": "sw1", "Credentials": "lab", "Criteria": ["sys"], "Output": "none"}]}`,
+		`{"Credentials": {"lab": {}}, "Devices": [{"Host": "sw1", "Credentials": "lab"}]}`,
+		`{"Devices": [{"Credentials": "lab"}]}`,
+		`{"Devices": `,
+	} {
+		if _, err := ReadConfig(strings.NewReader(cfg)); err == nil {
+			t.Errorf("expected error for config: %s", cfg)
+		}
+	}
+}
+
+func TestConfigChain(t *testing.T) {
+	var got []string
+	sink := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		got = append(got, fmt.Sprintf("%s=%v(%T) %v", name, value, value, tags))
+		return nil
+	}
+	sender, err := chain(sink, OutputConfig{
+		Recipes: Recipies{"ifInOctets": {}},
+		Regexps: []string{"^ifIn"},
+		Keep:    true,
+		Strip:   []string{"oid"},
+		Integer: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range []uint32{100, 150} {
+		ts := TimeStamp{Stop: time.Now()}
+		sender("ifInOctets", map[string]string{"oid": ".1.3.6.1.2.1.2.2.1.10.1"}, v, ts)
+		sender("ifOutOctets", map[string]string{"oid": ".1.3.6.1.2.1.2.2.1.16.1"}, v, ts)
+		if i == 0 && len(got) > 0 {
+			t.Errorf("expected no data for the first sample, got: %v", got)
+		}
+	}
+	if want := []string{"ifInOctets=50(int64) map[]"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got: %v", want, got)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	sysDescr    = ".1.3.6.1.2.1.1.1.0"
+	sysObjectID = ".1.3.6.1.2.1.1.2.0"
+	sysName     = ".1.3.6.1.2.1.1.5.0"
+	sysLocation = ".1.3.6.1.2.1.1.6.0"
+)
+
+// Identity is the basic identity of a device
+type Identity struct {
+	Name     string        // sysName
+	Descr    string        // sysDescr
+	ObjectID string        // sysObjectID
+	Location string        // sysLocation
+	Uptime   time.Duration // sysUpTime
+}
+
+// identify reads the identity of the device, which must have a sysObjectID
+func identify(client *gosnmp.GoSNMP) (Identity, error) {
+	var id Identity
+	fn := func(pdu gosnmp.SnmpPDU) error {
+		switch pdu.Name {
+		case sysObjectID:
+			id.ObjectID, _ = pdu.Value.(string)
+		case sysUpTime:
+			if ticks, err := counter(pdu.Value); err == nil {
+				id.Uptime = time.Duration(ticks) * 10 * time.Millisecond
+			}
+		case sysName, sysDescr, sysLocation:
+			b, _ := pdu.Value.([]byte)
+			s := cleanString(b)
+			switch pdu.Name {
+			case sysName:
+				id.Name = s
+			case sysDescr:
+				id.Descr = s
+			case sysLocation:
+				id.Location = s
+			}
+		}
+		return nil
+	}
+	if err := getAll(client, []string{sysObjectID, sysName, sysDescr, sysLocation, sysUpTime}, fn); err != nil {
+		return id, err
+	}
+	if len(id.ObjectID) == 0 {
+		return id, errors.Errorf("no sysObjectID found for %s", client.Target)
+	}
+	return id, nil
+}
+
+// Discoverer finds which of a number of candidate profiles works for a device
+type Discoverer struct {
+	Order   []string // versions in the order to try them (default is "3", "2c", "1")
+	Timeout int      // timeout in seconds for each candidate (default is 1)
+	Retries int      // retries for each candidate
+}
+
+// order returns the position of the version in the discovery order
+func (d Discoverer) order(version string) int {
+	order := d.Order
+	if len(order) == 0 {
+		order = []string{"3", "2c", "1"}
+	}
+	norm := func(v string) string {
+		if v == "" || v == "2" {
+			return "2c"
+		}
+		return v
+	}
+	for i, v := range order {
+		if norm(v) == norm(version) {
+			return i
+		}
+	}
+	return len(order)
+}
+
+type byVersion struct {
+	profiles []Profile
+	order    func(string) int
+}
+
+func (b byVersion) Len() int      { return len(b.profiles) }
+func (b byVersion) Swap(i, j int) { b.profiles[i], b.profiles[j] = b.profiles[j], b.profiles[i] }
+func (b byVersion) Less(i, j int) bool {
+	return b.order(b.profiles[i].Version) < b.order(b.profiles[j].Version)
+}
+
+// Discover tries each candidate profile against the host, in the order of
+// their versions, and returns the first that can read the device identity
+func (d Discoverer) Discover(host string, candidates []Profile) (Profile, Identity, error) {
+	if len(candidates) == 0 {
+		return Profile{}, Identity{}, errors.Errorf("no candidate profiles for %s", host)
+	}
+	timeout := d.Timeout
+	if timeout <= 0 {
+		timeout = 1
+	}
+	tries := make([]Profile, len(candidates))
+	copy(tries, candidates)
+	sort.Stable(byVersion{tries, d.order})
+
+	failed := make([]string, 0, len(tries))
+	for _, p := range tries {
+		p.Host = host
+		probe := p
+		probe.Timeout, probe.Retries = timeout, d.Retries
+		client, err := newClient(probe)
+		if err != nil {
+			failed = append(failed, errors.Wrapf(err, "v%s", p.Version).Error())
+			continue
+		}
+		id, err := identify(client)
+		client.Conn.Close()
+		if err != nil {
+			failed = append(failed, errors.Wrapf(err, "v%s", p.Version).Error())
+			continue
+		}
+		return p, id, nil
+	}
+	return Profile{}, Identity{}, errors.Errorf("no working profile for %s: %s", host, strings.Join(failed, "; "))
+}
+
+// Discover returns the first candidate profile that works for the host,
+// trying v3 profiles first, then v2c and v1
+func Discover(host string, candidates []Profile) (Profile, error) {
+	p, _, err := Discoverer{}.Discover(host, candidates)
+	return p, err
+}
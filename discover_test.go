@@ -0,0 +1,81 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestDiscover(t *testing.T) {
+	a := agentsim.New()
+	a.Community = "secret"
+	a.V3 = &gosnmp.UsmSecurityParameters{
+		UserName:                 "admin",
+		AuthenticationProtocol:   gosnmp.SHA,
+		AuthenticationPassphrase: "authpass",
+		PrivacyProtocol:          gosnmp.NoPriv,
+	}
+	a.Set(sysDescr, gosnmp.OctetString, "simulated switch")
+	a.Set(sysObjectID, gosnmp.ObjectIdentifier, ".1.3.6.1.4.1.9.1.1")
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Advance(time.Hour)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	v3 := func(user string) Profile {
+		return Profile{
+			Port:      a.Port(),
+			Version:   "3",
+			SecLevel:  "AuthNoPriv",
+			AuthUser:  user,
+			AuthPass:  "authpass",
+			AuthProto: "SHA",
+		}
+	}
+	candidates := []Profile{
+		{Port: a.Port(), Version: "1", Community: "secret"},
+		{Port: a.Port(), Version: "2c", Community: "secret", Timeout: 30},
+		v3("nobody"),
+		v3("admin"),
+	}
+
+	// v3 is tried first by default
+	p, err := Discover("127.0.0.1", candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host != "127.0.0.1" || p.Version != "3" || p.AuthUser != "admin" {
+		t.Errorf("expected v3 admin profile, got: %+v", p)
+	}
+
+	// the order is configurable and candidates keep their own settings
+	d := Discoverer{Order: []string{"2c", "1", "3"}}
+	p, id, err := d.Discover("127.0.0.1", candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Version != "2c" || p.Timeout != 30 {
+		t.Errorf("expected v2c profile, got: %+v", p)
+	}
+	if id.Name != "sw1" || id.ObjectID != ".1.3.6.1.4.1.9.1.1" || id.Descr != "simulated switch" || id.Uptime < time.Hour {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+
+	// devices must have a sysObjectID
+	a.Delete(sysObjectID)
+	if _, err := Discover("127.0.0.1", candidates[3:]); err == nil {
+		t.Error("expected error for device without sysObjectID")
+	}
+
+	if _, err := Discover("127.0.0.1", nil); err == nil {
+		t.Error("expected error for no candidates")
+	}
+}
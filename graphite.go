@@ -0,0 +1,219 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGraphiteTemplate is the metric path used if none is given
+const DefaultGraphiteTemplate = "snmp.{host}.{column}.{name}"
+
+var graphiteField = regexp.MustCompile(`\{(\w+)\}`)
+
+// GraphiteOptions controls how data is sent to Graphite
+type GraphiteOptions struct {
+	Template string        // metric path, with {name} and {tag} fields (default is DefaultGraphiteTemplate)
+	Pickle   bool          // use the pickle protocol rather than plaintext
+	Timeout  time.Duration // connect and write timeout (default is 5 seconds)
+}
+
+// GraphiteWriter sends data to a Graphite (carbon) server over TCP,
+// reconnecting as required
+type GraphiteWriter struct {
+	addr string
+	opts GraphiteOptions
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// graphiteName sanitizes a metric path component, replacing
+// the characters that Graphite does not allow
+func graphiteName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_', c == '-', c == ':':
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// graphitePath returns the metric path for the data per the template.
+// Fields for tags that are not set are left out of the path.
+func graphitePath(template, name string, tags map[string]string) string {
+	parts := strings.Split(template, ".")
+	path := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = graphiteField.ReplaceAllStringFunc(part, func(field string) string {
+			field = field[1 : len(field)-1]
+			if field == "name" {
+				return graphiteName(name)
+			}
+			return graphiteName(tags[field])
+		})
+		if len(part) > 0 {
+			path = append(path, part)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+// graphitePoint is a single metric value
+type graphitePoint struct {
+	path  string
+	value float64
+	ts    int64
+}
+
+// plaintext formats the points per the Graphite plaintext protocol
+func plaintext(points []graphitePoint) []byte {
+	var b bytes.Buffer
+	for _, p := range points {
+		b.WriteString(p.path)
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(p.value, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(p.ts, 10))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// pickle formats the points per the Graphite pickle protocol, a length
+// prefixed pickled list of (path, (timestamp, value)) tuples
+func pickle(points []graphitePoint) []byte {
+	var b bytes.Buffer
+	b.Write([]byte{0, 0, 0, 0}) // length, set below
+	b.Write([]byte{0x80, 2})    // protocol 2
+	b.WriteString("](")         // empty list, mark
+	for _, p := range points {
+		b.WriteByte('X') // unicode string
+		binary.Write(&b, binary.LittleEndian, uint32(len(p.path)))
+		b.WriteString(p.path)
+		if p.ts >= math.MinInt32 && p.ts <= math.MaxInt32 {
+			b.WriteByte('J') // 32 bit integer
+			binary.Write(&b, binary.LittleEndian, int32(p.ts))
+		} else {
+			b.WriteByte('G') // float
+			binary.Write(&b, binary.BigEndian, float64(p.ts))
+		}
+		b.WriteByte('G')
+		binary.Write(&b, binary.BigEndian, p.value)
+		b.Write([]byte{0x86, 0x86}) // tuple2 twice
+	}
+	b.WriteString("e.") // appends, stop
+	data := b.Bytes()
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	return data
+}
+
+// NewGraphiteWriter returns a GraphiteWriter for the server at addr (host:port)
+func NewGraphiteWriter(addr string, opts GraphiteOptions) *GraphiteWriter {
+	if len(opts.Template) == 0 {
+		opts.Template = DefaultGraphiteTemplate
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &GraphiteWriter{addr: addr, opts: opts}
+}
+
+// write sends the data, reconnecting once if the connection has failed.
+// After a partial write only the lines that were not completely written
+// are sent again, but a pickled payload is sent again in full as the
+// server discards incomplete ones. Data written before a connection
+// fails may still have been lost, so delivery is not guaranteed.
+// The lock must be held.
+func (g *GraphiteWriter) write(data []byte) error {
+	var err error
+	for try := 0; try < 2; try++ {
+		if g.conn == nil {
+			if g.conn, err = net.DialTimeout("tcp", g.addr, g.opts.Timeout); err != nil {
+				g.conn = nil
+				return errors.Wrap(err, "graphite connect")
+			}
+		}
+		g.conn.SetWriteDeadline(time.Now().Add(g.opts.Timeout))
+		var n int
+		if n, err = g.conn.Write(data); err == nil {
+			return nil
+		}
+		g.conn.Close()
+		g.conn = nil
+		if !g.opts.Pickle {
+			data = data[bytes.LastIndexByte(data[:n], '\n')+1:]
+			if len(data) == 0 {
+				return nil
+			}
+		}
+	}
+	return errors.Wrap(err, "graphite write")
+}
+
+// Send sends the samples, skipping non-numeric values.
+// It is a BatchSender, for use with BatchingSender.
+func (g *GraphiteWriter) Send(samples []Sample) error {
+	points := make([]graphitePoint, 0, len(samples))
+	for _, s := range samples {
+		value, ok := promFloat(s.Value)
+		if !ok || math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		ts := s.TimeStamp.Stop
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+		path := graphitePath(g.opts.Template, s.Name, s.Tags)
+		points = append(points, graphitePoint{path, value, ts.Unix()})
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	data := plaintext(points)
+	if g.opts.Pickle {
+		data = pickle(points)
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.write(data)
+}
+
+// Close closes the connection to the server
+func (g *GraphiteWriter) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
+}
+
+// GraphiteSender returns a Sender that sends data to the Graphite server
+// at addr (host:port). The metric path is built from the template, e.g.,
+// "snmp.{host}.{column}.{name}", with disallowed characters replaced
+// (so interface Gi1/0/1 becomes Gi1_0_1). The GraphiteWriter should be
+// closed when done.
+func GraphiteSender(addr string, opts GraphiteOptions) (Sender, *GraphiteWriter) {
+	g := NewGraphiteWriter(addr, opts)
+	return func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		return g.Send([]Sample{{name, tags, value, ts}})
+	}, g
+}
@@ -0,0 +1,218 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// graphiteServer accepts connections, passing on what is read from each
+func graphiteServer(t *testing.T) (net.Listener, chan []byte) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 4096)
+				for {
+					n, err := conn.Read(buf)
+					if n > 0 {
+						data <- append([]byte(nil), buf[:n]...)
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return l, data
+}
+
+func receive(t *testing.T, data chan []byte) []byte {
+	select {
+	case b := <-data:
+		return b
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for data")
+	}
+	return nil
+}
+
+func TestGraphitePath(t *testing.T) {
+	tags := map[string]string{"host": "sw1.example.com", "column": "Gi1/0/1"}
+	for template, want := range map[string]string{
+		DefaultGraphiteTemplate:         "snmp.sw1_example_com.Gi1_0_1.ifHCInOctets",
+		"net.{host}.if-{column}.{name}": "net.sw1_example_com.if-Gi1_0_1.ifHCInOctets",
+		"snmp.{host}.{missing}.{name}":  "snmp.sw1_example_com.ifHCInOctets",
+	} {
+		if got := graphitePath(template, "ifHCInOctets", tags); got != want {
+			t.Errorf("%s expected %s, got: %s", template, want, got)
+		}
+	}
+}
+
+func TestGraphitePlaintext(t *testing.T) {
+	l, data := graphiteServer(t)
+	defer l.Close()
+
+	sender, g := GraphiteSender(l.Addr().String(), GraphiteOptions{})
+	defer g.Close()
+	ts := TimeStamp{Stop: time.Unix(1500000000, 0)}
+	tags := map[string]string{"host": "sw1", "column": "Gi1/0/1"}
+	if err := sender("ifHCInOctets", tags, uint64(1234), ts); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender("ifDescr", tags, "uplink", ts); err != nil {
+		t.Fatal(err)
+	}
+	want := "snmp.sw1.Gi1_0_1.ifHCInOctets 1234 1500000000\n"
+	if got := string(receive(t, data)); got != want {
+		t.Errorf("expected %q, got: %q", want, got)
+	}
+
+	// the server going away forces a reconnect
+	g.mu.Lock()
+	g.conn.Close()
+	g.mu.Unlock()
+	if err := sender("ifHCInOctets", tags, 2.5, ts); err != nil {
+		t.Fatal(err)
+	}
+	want = "snmp.sw1.Gi1_0_1.ifHCInOctets 2.5 1500000000\n"
+	if got := string(receive(t, data)); got != want {
+		t.Errorf("expected %q, got: %q", want, got)
+	}
+}
+
+// partialConn is a connection that fails after writing n bytes
+type partialConn struct {
+	net.Conn
+	n int
+}
+
+func (c partialConn) Write(b []byte) (int, error)      { return c.n, fmt.Errorf("connection reset") }
+func (c partialConn) SetWriteDeadline(time.Time) error { return nil }
+func (c partialConn) Close() error                     { return nil }
+
+func TestGraphitePartial(t *testing.T) {
+	l, data := graphiteServer(t)
+	defer l.Close()
+
+	g := NewGraphiteWriter(l.Addr().String(), GraphiteOptions{})
+	defer g.Close()
+	ts := TimeStamp{Stop: time.Unix(1500000000, 0)}
+	first := "snmp.sw1.ifInOctets 1 1500000000\n"
+	g.conn = partialConn{n: len(first) + 5}
+
+	// the first line was written, so only the second is sent again
+	err := g.Send([]Sample{
+		{"ifInOctets", map[string]string{"host": "sw1"}, 1, ts},
+		{"ifOutOctets", map[string]string{"host": "sw1"}, 2, ts},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "snmp.sw1.ifOutOctets 2 1500000000\n"
+	if got := string(receive(t, data)); got != want {
+		t.Errorf("expected %q, got: %q", want, got)
+	}
+}
+
+func TestGraphitePickle(t *testing.T) {
+	l, data := graphiteServer(t)
+	defer l.Close()
+
+	g := NewGraphiteWriter(l.Addr().String(), GraphiteOptions{Pickle: true})
+	defer g.Close()
+	ts := TimeStamp{Stop: time.Unix(1500000000, 0)}
+	err := g.Send([]Sample{
+		{"ifHCInOctets", map[string]string{"host": "sw1", "column": "Gi1/0/1"}, uint64(1234), ts},
+		{"sysUpTime", map[string]string{"host": "sw1"}, 99, ts},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []byte
+	for len(got) < 4 || len(got) < 4+int(binary.BigEndian.Uint32(got)) {
+		got = append(got, receive(t, data)...)
+	}
+	if n := int(binary.BigEndian.Uint32(got)); n != len(got)-4 {
+		t.Fatalf("expected length %d, got: %d", len(got)-4, n)
+	}
+
+	// walk the opcodes to check the structure
+	r := bufio.NewReader(bytes.NewReader(got[4:]))
+	var paths []string
+	var values []float64
+	read := func(v interface{}, order binary.ByteOrder) {
+		if err := binary.Read(r, order, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for {
+		op, err := r.ReadByte()
+		if err == io.EOF {
+			t.Fatal("missing stop opcode")
+		}
+		switch op {
+		case 0x80:
+			r.ReadByte()
+		case ']', '(', 'e', 0x86:
+		case 'X':
+			var n uint32
+			read(&n, binary.LittleEndian)
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			paths = append(paths, string(b))
+		case 'J':
+			var ts int32
+			read(&ts, binary.LittleEndian)
+			if ts != 1500000000 {
+				t.Errorf("unexpected timestamp: %d", ts)
+			}
+		case 'G':
+			var f float64
+			read(&f, binary.BigEndian)
+			values = append(values, f)
+		case '.':
+			if want := "[snmp.sw1.Gi1_0_1.ifHCInOctets snmp.sw1.sysUpTime]"; fmt.Sprint(paths) != want {
+				t.Errorf("expected %s, got: %v", want, paths)
+			}
+			if want := "[1234 99]"; fmt.Sprint(values) != want {
+				t.Errorf("expected %s, got: %v", want, values)
+			}
+			return
+		default:
+			t.Fatalf("unexpected opcode: %#x", op)
+		}
+	}
+}
+
+func TestGraphiteDown(t *testing.T) {
+	l, _ := graphiteServer(t)
+	addr := l.Addr().String()
+	l.Close()
+	sender, g := GraphiteSender(addr, GraphiteOptions{Timeout: time.Second})
+	defer g.Close()
+	if err := sender("sysUpTime", nil, 1, TimeStamp{}); err == nil {
+		t.Error("expected error with no server")
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+// hintSpec is an octet-format specification of a DISPLAY-HINT (RFC 2579)
+type hintSpec struct {
+	repeat bool // first octet of the data is a repeat count
+	length int  // number of octets to consume
+	format byte // one of d, x, o, a, t
+	sep    byte // optional separator after each application
+	term   byte // optional terminator after a repeated group
+}
+
+// notSpecial returns true if c can be used as a separator or terminator
+func notSpecial(c byte) bool {
+	return c != '*' && (c < '0' || c > '9')
+}
+
+// parseHint parses an OCTET STRING display hint
+func parseHint(hint string) ([]hintSpec, error) {
+	specs := []hintSpec{}
+	for i := 0; i < len(hint); {
+		var spec hintSpec
+		if hint[i] == '*' {
+			spec.repeat = true
+			i++
+		}
+		start := i
+		for i < len(hint) && hint[i] >= '0' && hint[i] <= '9' {
+			i++
+		}
+		if start == i {
+			return nil, errors.Errorf("hint %q has no length at offset %d", hint, i)
+		}
+		spec.length, _ = strconv.Atoi(hint[start:i])
+		if spec.length == 0 || i == len(hint) {
+			return nil, errors.Errorf("invalid hint: %q", hint)
+		}
+		spec.format = hint[i]
+		if !strings.ContainsRune("dxoat", rune(spec.format)) {
+			return nil, errors.Errorf("hint %q has invalid format: %c", hint, spec.format)
+		}
+		i++
+		if i < len(hint) && notSpecial(hint[i]) {
+			spec.sep = hint[i]
+			i++
+		}
+		if spec.repeat && i < len(hint) && notSpecial(hint[i]) {
+			spec.term = hint[i]
+			i++
+		}
+		specs = append(specs, spec)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("empty hint")
+	}
+	return specs, nil
+}
+
+// displayOctets renders data per an OCTET STRING display hint,
+// the last specification being applied to any remaining data
+func displayOctets(hint string, data []byte) (string, error) {
+	specs, err := parseHint(hint)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for i := 0; len(data) > 0; i++ {
+		spec := specs[len(specs)-1]
+		if i < len(specs) {
+			spec = specs[i]
+		}
+		count := 1
+		if spec.repeat {
+			count = int(data[0])
+			data = data[1:]
+		}
+		for j := 0; j < count && len(data) > 0; j++ {
+			n := spec.length
+			if n > len(data) {
+				n = len(data)
+			}
+			chunk := data[:n]
+			data = data[n:]
+
+			// chunks may be longer than any integer type
+			switch spec.format {
+			case 'a', 't':
+				b.WriteString(cleanString(chunk))
+			case 'x':
+				b.WriteString(hex.EncodeToString(chunk))
+			case 'd':
+				b.WriteString(new(big.Int).SetBytes(chunk).Text(10))
+			case 'o':
+				b.WriteString(new(big.Int).SetBytes(chunk).Text(8))
+			}
+			if len(data) == 0 {
+				break
+			}
+			if spec.term != 0 && j == count-1 {
+				b.WriteByte(spec.term)
+			} else if spec.sep != 0 {
+				b.WriteByte(spec.sep)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// displayInteger renders an integer per an INTEGER display hint,
+// returning a float for implied decimal points (e.g., "d-2")
+func displayInteger(hint string, v int) (interface{}, error) {
+	if len(hint) == 0 {
+		return nil, errors.New("empty hint")
+	}
+	switch hint[0] {
+	case 'd':
+		if len(hint) == 1 {
+			return v, nil
+		}
+		places, err := strconv.Atoi(strings.TrimPrefix(hint[1:], "-"))
+		if err != nil || hint[1] != '-' {
+			return nil, errors.Errorf("invalid hint: %q", hint)
+		}
+		return float64(v) / math.Pow10(places), nil
+	case 'x':
+		return strconv.FormatInt(int64(v), 16), nil
+	case 'o':
+		return strconv.FormatInt(int64(v), 8), nil
+	case 'b':
+		return strconv.FormatInt(int64(v), 2), nil
+	}
+	return nil, errors.Errorf("invalid hint: %q", hint)
+}
+
+// hintFormatter returns a pduReader that renders values per the
+// display hint, or nil if the hint is not valid or is plain text
+// (e.g., "255a"), as such strings may hold numbers
+func hintFormatter(hint string) pduReader {
+	switch hint[0] {
+	case 'd', 'x', 'o', 'b':
+		// integer hints have a single format character
+		if _, err := displayInteger(hint, 0); err == nil {
+			return func(pdu gosnmp.SnmpPDU) (interface{}, error) {
+				switch v := pdu.Value.(type) {
+				case int:
+					return displayInteger(hint, v)
+				case uint:
+					if pdu.Type == gosnmp.Gauge32 || pdu.Type == gosnmp.Uinteger32 {
+						return displayInteger(hint, int(v))
+					}
+				case uint32:
+					if pdu.Type == gosnmp.Gauge32 || pdu.Type == gosnmp.Uinteger32 {
+						return displayInteger(hint, int(v))
+					}
+				}
+				return pduType(pdu)
+			}
+		}
+	}
+	specs, err := parseHint(hint)
+	if err != nil {
+		return nil
+	}
+	if len(specs) == 1 && !specs[0].repeat && (specs[0].format == 'a' || specs[0].format == 't') {
+		return nil
+	}
+	return func(pdu gosnmp.SnmpPDU) (interface{}, error) {
+		if b, ok := pdu.Value.([]byte); ok && pdu.Type == gosnmp.OctetString {
+			return displayOctets(hint, b)
+		}
+		return pduType(pdu)
+	}
+}
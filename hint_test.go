@@ -0,0 +1,105 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+func TestHintOctets(t *testing.T) {
+	tests := []struct {
+		hint string
+		data []byte
+		want string
+	}{
+		{"1x:", []byte{0x00, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}, "00:1a:2b:3c:4d:5e"},
+		{"255a", []byte("eth0"), "eth0"},
+		{"1d.1d.1d.1d", []byte{10, 0, 0, 1}, "10.0.0.1"},
+		{"1d.", []byte{192, 168, 1, 254}, "192.168.1.254"},
+		{"2d", []byte{0x01, 0x00}, "256"},
+		{"2x", []byte{0x00, 0x0f}, "000f"},
+		{"16x", []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x01}, "fe800000000000000000000000000001"},
+		{"9d", []byte{1, 0, 0, 0, 0, 0, 0, 0, 0}, "18446744073709551616"},
+		{"1o", []byte{8}, "10"},
+		{"4d.2d.", []byte{0, 0, 1, 0, 0, 2, 0, 3}, "256.2.3"},
+		{"*1d./1d", []byte{3, 1, 2, 3, 4}, "1.2.3/4"},
+		{"1d-1d", []byte{5}, "5"},
+		{"1x:", []byte{}, ""},
+	}
+	for _, test := range tests {
+		got, err := displayOctets(test.hint, test.data)
+		if err != nil {
+			t.Errorf("hint %q: %v", test.hint, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("hint %q expected %q, got %q", test.hint, test.want, got)
+		}
+	}
+	for _, hint := range []string{"", "x", "1q", "*x", "0d"} {
+		if _, err := parseHint(hint); err == nil {
+			t.Errorf("expected error for hint %q", hint)
+		}
+	}
+}
+
+func TestHintInteger(t *testing.T) {
+	tests := []struct {
+		hint string
+		v    int
+		want interface{}
+	}{
+		{"d", 42, 42},
+		{"d-2", 1234, 12.34},
+		{"x", 255, "ff"},
+		{"o", 8, "10"},
+		{"b", 5, "101"},
+	}
+	for _, test := range tests {
+		got, err := displayInteger(test.hint, test.v)
+		if err != nil {
+			t.Errorf("hint %q: %v", test.hint, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("hint %q expected %v, got %v", test.hint, test.want, got)
+		}
+	}
+	if _, err := displayInteger("d2", 1); err == nil {
+		t.Error("expected error for invalid hint")
+	}
+}
+
+func TestHintFunc(t *testing.T) {
+	// hints inherited from a textual convention drive the formatting
+	fn := pduFunc(MibInfo{Syntax: "OCTET STRING", Hint: "1x:"})
+	v, err := fn(gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte{0xde, 0xad, 0xbe, 0xef}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "de:ad:be:ef" {
+		t.Errorf("expected de:ad:be:ef, got %v", v)
+	}
+
+	fn = pduFunc(MibInfo{Syntax: "Integer32", Hint: "d-1"})
+	if v, _ = fn(gosnmp.SnmpPDU{Type: gosnmp.Integer, Value: 215}); v != 21.5 {
+		t.Errorf("expected 21.5, got %v", v)
+	}
+
+	// plain text may hold numbers
+	fn = pduFunc(MibInfo{Syntax: "OCTET STRING", Hint: "255a"})
+	if v, _ = fn(gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("0.50")}); v != 0.5 {
+		t.Errorf("expected 0.5, got %v (%T)", v, v)
+	}
+
+	fn = pduFunc(MibInfo{Syntax: "Integer32", Hint: "d-1"})
+
+	// values of other types are unaffected
+	if v, _ = fn(gosnmp.SnmpPDU{Type: gosnmp.Counter32, Value: uint(7)}); v != uint32(7) {
+		t.Errorf("expected uint32(7), got %v (%T)", v, v)
+	}
+}
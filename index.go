@@ -0,0 +1,180 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var fixedSize = regexp.MustCompile(`SIZE\s*\(\s*([0-9]+)\s*\)`)
+
+// indexPart is a component of a table index
+type indexPart struct {
+	Name    string
+	Implied bool
+	Mib     MibInfo
+}
+
+// entryIndex returns the index components of a table entry,
+// using the index of the entry it augments if need be
+func entryIndex(entry MibInfo) ([]indexPart, error) {
+	clause := entry.Index
+	if len(clause) == 0 && len(entry.Augments) > 0 {
+		name := strings.Trim(entry.Augments, "{} ")
+		info, ok := nameInfo(name)
+		if !ok {
+			return nil, errors.Errorf("cannot find %s augmented by %s", name, entry.Name)
+		}
+		clause = info.Mib.Index
+	}
+	clause = strings.Trim(clause, "{} ")
+	if len(clause) == 0 {
+		return nil, errors.Errorf("no index found for %s", entry.Name)
+	}
+	parts := []indexPart{}
+	for _, name := range strings.Split(clause, ",") {
+		part := indexPart{Name: strings.TrimSpace(name)}
+		if strings.HasPrefix(part.Name, "IMPLIED ") {
+			part.Implied = true
+			part.Name = strings.TrimSpace(part.Name[len("IMPLIED "):])
+		}
+		if info, ok := nameInfo(part.Name); ok {
+			part.Mib = info.Mib
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
+// isOctets returns true if the syntax is a string type
+func isOctets(syntax string) bool {
+	return strings.HasPrefix(syntax, "OCTET STRING") ||
+		strings.HasSuffix(syntax, "String") ||
+		(strings.HasSuffix(syntax, "Address") && syntax != "IpAddress")
+}
+
+// indexValue decodes the value of the index part from the sub-identifiers,
+// returning the value and the number of sub-identifiers used
+func indexValue(part indexPart, subs []int) (interface{}, int, error) {
+	syntax := part.Mib.Syntax
+	short := errors.Errorf("index %s is truncated", part.Name)
+
+	// variable length values are prefixed by their length unless implied
+	length := func() (int, int, error) {
+		if part.Implied {
+			return len(subs), 0, nil
+		}
+		if len(subs) == 0 || subs[0] > len(subs)-1 {
+			return 0, 0, short
+		}
+		return subs[0], 1, nil
+	}
+
+	switch {
+	case strings.HasPrefix(syntax, "IpAddress"):
+		if len(subs) < 4 {
+			return nil, 0, short
+		}
+		return net.IPv4(byte(subs[0]), byte(subs[1]), byte(subs[2]), byte(subs[3])).String(), 4, nil
+	case isOctets(syntax):
+		var n, start int
+		if m := fixedSize.FindStringSubmatch(syntax); len(m) > 1 {
+			n, _ = strconv.Atoi(m[1])
+		} else if syntax == "MacAddress" {
+			n = 6
+		} else {
+			var err error
+			if n, start, err = length(); err != nil {
+				return nil, 0, err
+			}
+		}
+		if start+n > len(subs) {
+			return nil, 0, short
+		}
+		b := make([]byte, n)
+		for i, c := range subs[start : start+n] {
+			if c < 0 || c > 255 {
+				return nil, 0, errors.Errorf("index %s has invalid octet: %d", part.Name, c)
+			}
+			b[i] = byte(c)
+		}
+		if len(part.Mib.Hint) > 0 {
+			if s, err := displayOctets(part.Mib.Hint, b); err == nil {
+				return s, start + n, nil
+			}
+		}
+		return octetIndex(b), start + n, nil
+	case strings.HasPrefix(syntax, "OBJECT IDENTIFIER"), syntax == "AutonomousType":
+		n, start, err := length()
+		if err != nil {
+			return nil, 0, err
+		}
+		words := make([]string, n)
+		for i, c := range subs[start : start+n] {
+			words[i] = strconv.Itoa(c)
+		}
+		return "." + strings.Join(words, "."), start + n, nil
+	}
+	// integers and enumerations
+	if len(subs) == 0 {
+		return nil, 0, short
+	}
+	if kind, labels := looker(syntax); kind == "INTEGER" {
+		if label, ok := labels[subs[0]]; ok {
+			return label, 1, nil
+		}
+	}
+	return subs[0], 1, nil
+}
+
+// octetIndex returns printable strings as is, otherwise as hex octets
+func octetIndex(b []byte) string {
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			hex := make([]string, len(b))
+			for i, c := range b {
+				hex[i] = fmt.Sprintf("%02x", c)
+			}
+			return strings.Join(hex, ":")
+		}
+	}
+	return string(b)
+}
+
+// decodeIndex decodes an OID suffix into its index values
+func decodeIndex(parts []indexPart, suffix string) ([]interface{}, error) {
+	if len(suffix) == 0 {
+		return nil, errors.New("no index found")
+	}
+	subs := Octets(suffix)
+	values := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		v, n, err := indexValue(part, subs)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		subs = subs[n:]
+	}
+	if len(subs) > 0 {
+		return nil, errors.Errorf("index %s has extra sub-identifiers", suffix)
+	}
+	return values, nil
+}
+
+// indexKey joins the index values into a single key
+func indexKey(values []interface{}) string {
+	words := make([]string, len(values))
+	for i, v := range values {
+		words[i] = fmt.Sprint(v)
+	}
+	return strings.Join(words, ".")
+}
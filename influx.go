@@ -0,0 +1,344 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	measurementEscape = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	tagEscape         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+	stringEscape      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// InfluxOptions controls how data is formatted as InfluxDB line protocol
+type InfluxOptions struct {
+	Precision time.Duration     // timestamp precision (default is nanoseconds)
+	Unsigned  bool              // write unsigned integers with a 'u' suffix (allows values beyond int64)
+	Tags      map[string]string // any additional tags to associate
+}
+
+// influxValue formats a value as a line protocol field value
+func influxValue(value interface{}, unsigned bool) (string, error) {
+	unsignedValue := func(u uint64) (string, error) {
+		if unsigned {
+			return strconv.FormatUint(u, 10) + "u", nil
+		}
+		// the field type must not change between writes, so large
+		// values can't be written as floats (use Unsigned instead)
+		if u > math.MaxInt64 {
+			return "", errors.Errorf("value %d is too large for an integer field", u)
+		}
+		return strconv.FormatUint(u, 10) + "i", nil
+	}
+	floatValue := func(f float64) (string, error) {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", errors.Errorf("invalid float value: %v", f)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	switch v := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(v), 10) + "i", nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i", nil
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", nil
+	case uint:
+		return unsignedValue(uint64(v))
+	case uint32:
+		return unsignedValue(uint64(v))
+	case uint64:
+		return unsignedValue(v)
+	case float32:
+		return floatValue(float64(v))
+	case float64:
+		return floatValue(v)
+	case bool:
+		return strconv.FormatBool(v), nil
+	case string:
+		return `"` + stringEscape.Replace(v) + `"`, nil
+	case []byte:
+		return `"` + stringEscape.Replace(cleanString(v)) + `"`, nil
+	case time.Time:
+		return `"` + v.Format(time.RFC3339Nano) + `"`, nil
+	case nil:
+		return "", errors.New("nil value")
+	default:
+		return `"` + stringEscape.Replace(fmt.Sprint(v)) + `"`, nil
+	}
+}
+
+// influxLine formats the data as a line of line protocol.
+// If measurement is empty the name is used as the measurement with
+// a field named "value", otherwise the name is used as the field key.
+func influxLine(measurement, name string, tags map[string]string, value interface{}, ts TimeStamp, opts InfluxOptions) (string, error) {
+	field := "value"
+	if len(measurement) == 0 {
+		measurement = name
+	} else {
+		field = name
+	}
+	v, err := influxValue(value, opts.Unsigned)
+	if err != nil {
+		return "", errors.Wrapf(err, "field %s", name)
+	}
+
+	all := make(map[string]string, len(tags)+len(opts.Tags))
+	for k, v := range opts.Tags {
+		all[k] = v
+	}
+	for k, v := range tags {
+		all[k] = v
+	}
+	keys := make([]string, 0, len(all))
+	for k, v := range all {
+		// empty tag values are not permitted
+		if len(k) > 0 && len(v) > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	b.WriteString(measurementEscape.Replace(measurement))
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(tagEscape.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscape.Replace(all[k]))
+	}
+	b.WriteByte(' ')
+	b.WriteString(tagEscape.Replace(field))
+	b.WriteByte('=')
+	b.WriteString(v)
+	if !ts.Stop.IsZero() {
+		precision := opts.Precision
+		if precision <= 0 {
+			precision = time.Nanosecond
+		}
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(ts.Stop.UnixNano()/int64(precision), 10))
+	}
+	b.WriteByte('\n')
+	return b.String(), nil
+}
+
+// InfluxSender returns a Sender that writes data to w as InfluxDB line protocol
+func InfluxSender(w io.Writer, measurement string, opts InfluxOptions) Sender {
+	var m sync.Mutex
+	return func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		line, err := influxLine(measurement, name, tags, value, ts, opts)
+		if err != nil {
+			return err
+		}
+		m.Lock()
+		defer m.Unlock()
+		_, err = io.WriteString(w, line)
+		return err
+	}
+}
+
+// InfluxWriter buffers line protocol and posts it in batches
+// to an InfluxDB HTTP write endpoint
+type InfluxWriter struct {
+	URL     string       // e.g., http://localhost:8086/write?db=snmp
+	Client  *http.Client // client used to post data
+	batch   int
+	lines   int
+	buf     bytes.Buffer
+	mu      sync.Mutex
+	posted  *sync.Cond // signalled when a post completes
+	posting bool
+	backoff time.Duration
+	retry   time.Time // when to post again after a failure
+	done    chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+const (
+	// influxBacklog is the most lines kept for reposting while posts fail
+	influxBacklog = 100000
+
+	// limits of the delay before reposting after a failure
+	influxMinBackoff = time.Second
+	influxMaxBackoff = time.Minute
+)
+
+// NewInfluxWriter returns an InfluxWriter that posts to url whenever
+// batch lines have been written, and every interval if it is non-zero.
+// Data that fails to post because the server is unreachable or has an
+// error is kept and posted again, after a delay that increases with each
+// failure, by later writes, the interval or Flush.
+func NewInfluxWriter(url string, batch int, interval time.Duration) *InfluxWriter {
+	w := &InfluxWriter{
+		URL:    url,
+		Client: http.DefaultClient,
+		batch:  batch,
+		done:   make(chan struct{}),
+	}
+	w.posted = sync.NewCond(&w.mu)
+	if interval > 0 {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					w.send(false)
+				case <-w.done:
+					return
+				}
+			}
+		}()
+	}
+	return w
+}
+
+// Write buffers line protocol, posting it if the batch size is reached
+func (w *InfluxWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	n, _ := w.buf.Write(p)
+	w.lines += bytes.Count(p, []byte{'\n'})
+	if w.lines > influxBacklog {
+		w.trim()
+	}
+	full := w.batch > 0 && w.lines >= w.batch
+	w.mu.Unlock()
+	if full {
+		return n, w.send(false)
+	}
+	return n, nil
+}
+
+// Flush posts any buffered data, waiting for any post in progress
+func (w *InfluxWriter) Flush() error {
+	return w.send(true)
+}
+
+// Close stops periodic flushing and posts any buffered data.
+// It is safe to call more than once.
+func (w *InfluxWriter) Close() error {
+	w.once.Do(func() { close(w.done) })
+	w.wg.Wait()
+	return w.Flush()
+}
+
+// trim drops the oldest lines beyond the backlog limit,
+// the lock must be held
+func (w *InfluxWriter) trim() {
+	data := w.buf.Bytes()
+	for ; w.lines > influxBacklog; w.lines-- {
+		data = data[bytes.IndexByte(data, '\n')+1:]
+	}
+	var b bytes.Buffer
+	b.Write(data)
+	w.buf = b
+}
+
+// requeue keeps data that failed to post for the next post,
+// the lock must be held
+func (w *InfluxWriter) requeue(body []byte) {
+	var b bytes.Buffer
+	b.Write(body)
+	b.Write(w.buf.Bytes())
+	w.buf = b
+	w.lines = bytes.Count(b.Bytes(), []byte{'\n'})
+	w.trim()
+}
+
+// send posts the buffered data, unless another post is in progress or
+// posting is being delayed after a failure. If wait is true it instead
+// waits for any post in progress and ignores any delay.
+func (w *InfluxWriter) send(wait bool) error {
+	w.mu.Lock()
+	if wait {
+		for w.posting {
+			w.posted.Wait()
+		}
+	} else if w.posting || time.Now().Before(w.retry) {
+		w.mu.Unlock()
+		return nil
+	}
+	if w.buf.Len() == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	body := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	w.lines = 0
+	w.posting = true
+	w.mu.Unlock()
+
+	// other writes are buffered while posting
+	keep, err := w.post(body)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.posting = false
+	w.posted.Broadcast()
+	switch {
+	case keep:
+		w.requeue(body)
+		if w.backoff *= 2; w.backoff < influxMinBackoff {
+			w.backoff = influxMinBackoff
+		} else if w.backoff > influxMaxBackoff {
+			w.backoff = influxMaxBackoff
+		}
+		w.retry = time.Now().Add(w.backoff)
+	case err == nil:
+		w.backoff = 0
+		w.retry = time.Time{}
+	}
+	return err
+}
+
+// post sends the data, returning true if it should be posted again
+// because the server could not be reached or had an error, but not if
+// the server rejected it (as retrying won't help)
+func (w *InfluxWriter) post(body []byte) (bool, error) {
+	resp, err := w.Client.Post(w.URL, "text/plain; charset=utf-8", bytes.NewReader(body))
+	if err != nil {
+		return true, errors.Wrap(err, "influx write")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode/100 == 5, errors.Errorf("influx write failed (%s): %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
+
+// InfluxHTTPSender returns a Sender that posts line protocol to an
+// InfluxDB write url in batches. The InfluxWriter should be closed
+// when done to post any remaining data.
+func InfluxHTTPSender(url, measurement string, batch int, interval time.Duration, opts InfluxOptions) (Sender, *InfluxWriter) {
+	w := NewInfluxWriter(url, batch, interval)
+	// the writer does its own locking, so senders aren't held up by posts
+	return func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		line, err := influxLine(measurement, name, tags, value, ts, opts)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(line))
+		return err
+	}, w
+}
@@ -0,0 +1,156 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestInfluxSender(t *testing.T) {
+	ts := TimeStamp{Stop: time.Unix(1465000000, 123)}
+	tags := map[string]string{
+		"host":   "sw1",
+		"column": "Gi1/0/1",
+		"alias":  "uplink, core=1",
+		"empty":  "",
+	}
+	for _, test := range []struct {
+		measurement string
+		name        string
+		value       interface{}
+		opts        InfluxOptions
+		want        string
+	}{
+		{"snmp", "ifHCInOctets", uint64(1234), InfluxOptions{},
+			`snmp,alias=uplink\,\ core\=1,column=Gi1/0/1,host=sw1 ifHCInOctets=1234i 1465000000000000123`},
+		{"snmp", "ifHCInOctets", uint64(math.MaxUint64), InfluxOptions{Unsigned: true},
+			`snmp,alias=uplink\,\ core\=1,column=Gi1/0/1,host=sw1 ifHCInOctets=18446744073709551615u 1465000000000000123`},
+		{"snmp", "ifInErrors", uint32(7), InfluxOptions{Unsigned: true},
+			`snmp,alias=uplink\,\ core\=1,column=Gi1/0/1,host=sw1 ifInErrors=7u 1465000000000000123`},
+		{"", "ifAlias", `say "hi"`, InfluxOptions{Precision: time.Second},
+			`ifAlias,alias=uplink\,\ core\=1,column=Gi1/0/1,host=sw1 value="say \"hi\"" 1465000000`},
+		{"my data", "rate", 1.5, InfluxOptions{Tags: map[string]string{"site": "dc1"}},
+			`my\ data,alias=uplink\,\ core\=1,column=Gi1/0/1,host=sw1,site=dc1 rate=1.5 1465000000000000123`},
+	} {
+		var b bytes.Buffer
+		sender := InfluxSender(&b, test.measurement, test.opts)
+		if err := sender(test.name, tags, test.value, ts); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := strings.TrimSpace(b.String()); got != test.want {
+			t.Errorf("expected:\n%s\ngot:\n%s", test.want, got)
+		}
+	}
+
+	// values that don't fit an integer field are not silently changed
+	var b bytes.Buffer
+	sender := InfluxSender(&b, "snmp", InfluxOptions{})
+	if err := sender("ifHCInOctets", tags, uint64(math.MaxInt64+1), ts); err == nil {
+		t.Errorf("expected error for out of range value, got: %q", b.String())
+	}
+}
+
+func TestInfluxHTTPSender(t *testing.T) {
+	var m sync.Mutex
+	posts := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		m.Lock()
+		posts = append(posts, string(b))
+		m.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender, w := InfluxHTTPSender(server.URL+"/write?db=snmp", "snmp", 2, 0, InfluxOptions{})
+	ts := TimeStamp{Stop: time.Now()}
+	tags := map[string]string{"host": "sw1"}
+	for i := 0; i < 3; i++ {
+		if err := sender("sysUpTime", tags, i, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Lock()
+	if len(posts) != 1 || strings.Count(posts[0], "\n") != 2 {
+		t.Errorf("expected one batch of 2 lines, got: %q", posts)
+	}
+	m.Unlock()
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+	if len(posts) != 2 || strings.Count(posts[1], "\n") != 1 {
+		t.Errorf("expected remaining line to be flushed, got: %q", posts)
+	}
+	m.Unlock()
+
+	// errors from the server are reported
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "database not found", http.StatusNotFound)
+	}))
+	defer bad.Close()
+	sender, w = InfluxHTTPSender(bad.URL, "snmp", 1, 0, InfluxOptions{})
+	if err := sender("sysUpTime", tags, 1, ts); err == nil {
+		t.Error("expected error from failed write")
+	}
+	w.Close()
+	// must not panic
+	w.Close()
+}
+
+func TestInfluxRequeue(t *testing.T) {
+	var m sync.Mutex
+	fail := true
+	hits := 0
+	posts := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		m.Lock()
+		defer m.Unlock()
+		hits++
+		if fail {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		posts = append(posts, string(b))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender, w := InfluxHTTPSender(server.URL, "snmp", 1, 0, InfluxOptions{})
+	ts := TimeStamp{Stop: time.Now()}
+	if err := sender("sysUpTime", nil, 1, ts); err == nil {
+		t.Error("expected error from failed write")
+	}
+	m.Lock()
+	fail = false
+	m.Unlock()
+
+	// writes are buffered rather than reposted while backing off
+	if err := sender("sysUpTime", nil, 2, ts); err != nil {
+		t.Fatal(err)
+	}
+	m.Lock()
+	if hits != 1 {
+		t.Errorf("expected no repost while backing off, got %d posts", hits)
+	}
+	m.Unlock()
+	w.Close()
+	m.Lock()
+	defer m.Unlock()
+	if len(posts) != 1 || strings.Count(posts[0], "\n") != 2 {
+		t.Errorf("expected failed line to be reposted, got: %q", posts)
+	}
+}
@@ -41,6 +41,7 @@ type MibInfo struct {
 type oidInfo struct {
 	Name  string
 	Index int
+	Mib   MibInfo
 	Fn    pduReader
 }
 
@@ -89,10 +90,10 @@ func oidReader(m MibInfo) {
 	if index > 0 {
 		index += 2
 	}
-	oid := m.OID
-	if oid[0] != '.' {
-		oid = "." + oid
+	if m.OID[0] != '.' {
+		m.OID = "." + m.OID
 	}
+	oid := m.OID
 	name := m.Name[index:]
 	mu.Lock()
 	if o, ok := lookupOID[name]; ok {
@@ -103,12 +104,23 @@ func oidReader(m MibInfo) {
 		lookupOID[name] = oid
 	}
 	mu.Unlock()
-	oidBase[oid] = oidInfo{Name: m.Name, Index: index, Fn: pduFunc(m)}
+	oidBase[oid] = oidInfo{Name: m.Name, Index: index, Mib: m, Fn: pduFunc(m)}
 	rtree, _, _ = rtree.Insert([]byte(oid), name)
 }
 
+// nameInfo returns the info for the named OID
+func nameInfo(name string) (oidInfo, bool) {
+	mu.Lock()
+	oid, ok := lookupOID[name]
+	mu.Unlock()
+	if !ok {
+		return oidInfo{}, false
+	}
+	info, ok := oidBase[oid]
+	return info, ok
+}
+
 // pduFunc returns a pduReader based upon the OID type and hints
-// TODO: add other hinted formats functions here
 func pduFunc(m MibInfo) pduReader {
 	if m.Hint == "2d-1d-1d,1d:1d:1d.1d,1a1d:1d" {
 		return dateTime
@@ -116,6 +128,11 @@ func pduFunc(m MibInfo) pduReader {
 	if fn := numberType(m.Syntax); fn != nil {
 		return fn
 	}
+	if len(m.Hint) > 0 {
+		if fn := hintFormatter(m.Hint); fn != nil {
+			return fn
+		}
+	}
 	return pduType
 }
 
@@ -176,8 +193,18 @@ func OIDList(mib string, oids []string, w io.Writer) error {
 	return mibTranslate(mib, printMibInfo(w))
 }
 
-// oidNames returns the OIDs and their names from the mib(s) specified
+// oidNames returns the OIDs and their names from the mib(s) specified,
+// using snmptranslate only if the MIBs cannot be parsed natively
 func oidNames(mib string) (map[string]string, error) {
+	m, err := smiNames(mib)
+	if err == nil || len(snmptranslate) == 0 {
+		return m, err
+	}
+	return translateNames(mib)
+}
+
+// translateNames returns the OIDs and their names using snmptranslate
+func translateNames(mib string) (map[string]string, error) {
 	m := make(map[string]string)
 	if len(snmptranslate) == 0 {
 		return m, fmt.Errorf("snmptranslate is not found in current PATH")
@@ -208,6 +235,30 @@ func oidNames(mib string) (map[string]string, error) {
 
 // oidTranslate applies detailed OID info to fn
 func oidTranslate(mib string, oids []string, fn mibFunc) error {
+	s, err := loadSMI(mib)
+	if err != nil && len(snmptranslate) > 0 {
+		return translateOIDs(mib, oids, fn)
+	}
+	if err != nil {
+		return err
+	}
+	want := make(map[string]bool)
+	for _, oid := range oids {
+		if !strings.HasPrefix(oid, ".") {
+			oid = "." + oid
+		}
+		want[oid] = true
+	}
+	s.walk(func(m MibInfo) {
+		if want[m.OID] {
+			fn(m)
+		}
+	})
+	return nil
+}
+
+// translateOIDs applies detailed OID info from snmptranslate to fn
+func translateOIDs(mib string, oids []string, fn mibFunc) error {
 	var (
 		pipeIn  = make(chan string)
 		pipeOut = make(chan MibInfo, 32000)
@@ -246,7 +297,11 @@ func oidTranslate(mib string, oids []string, fn mibFunc) error {
 
 // mibTranslate applies detailed OID info to fn
 func mibTranslate(mib string, fn mibFunc) error {
-	info, err := oidNames(mib)
+	err := ParseMIBs(mib, fn)
+	if err == nil || len(snmptranslate) == 0 {
+		return err
+	}
+	info, err := translateNames(mib)
 	if err != nil {
 		return err
 	}
@@ -254,7 +309,7 @@ func mibTranslate(mib string, fn mibFunc) error {
 	for _, v := range info {
 		oids = append(oids, v)
 	}
-	return oidTranslate(mib, oids, fn)
+	return translateOIDs(mib, oids, fn)
 }
 
 // parseMibInfo translates output from snmptranslate into structured data
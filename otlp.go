@@ -0,0 +1,279 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OTLP/JSON encoding of metrics, per opentelemetry-proto.
+// 64 bit integers (including timestamps) are encoded as strings.
+
+const otlpCumulative = 2 // AGGREGATION_TEMPORALITY_CUMULATIVE
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpPoint struct {
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsInt             string     `json:"asInt,omitempty"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+}
+
+type otlpSum struct {
+	AggregationTemporality int         `json:"aggregationTemporality"`
+	IsMonotonic            bool        `json:"isMonotonic"`
+	DataPoints             []otlpPoint `json:"dataPoints"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpPoint `json:"dataPoints"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Unit  string     `json:"unit,omitempty"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+// OTLPOptions controls how data is exported
+type OTLPOptions struct {
+	Batch    int               // samples per export
+	Idle     time.Duration     // time a walk is quiet before it is exported (default 1s)
+	Headers  map[string]string // HTTP headers to add (e.g., for authorization)
+	Resource map[string]string // additional resource attributes
+}
+
+// OTLPWriter exports samples as OpenTelemetry metrics using OTLP/JSON
+// over HTTP. The host tag becomes the "host.name" resource attribute,
+// and other tags become data point attributes. Counters are exported
+// as cumulative sums starting when the agent was last restarted (per
+// its sysUpTime), other numbers as gauges. Non-numeric values are skipped,
+// as are unsigned values beyond the range of an int64 (which OTLP cannot
+// represent as an int, and which would break a series if sent as doubles).
+type OTLPWriter struct {
+	URL     string       // e.g., http://localhost:4318/v1/metrics
+	Client  *http.Client // client used to post data
+	headers map[string]string
+	attrs   map[string]string
+}
+
+// NewOTLPWriter returns an OTLPWriter that posts to url
+func NewOTLPWriter(url string, opts OTLPOptions) *OTLPWriter {
+	return &OTLPWriter{
+		URL:     url,
+		Client:  http.DefaultClient,
+		headers: opts.Headers,
+		attrs:   opts.Resource,
+	}
+}
+
+type otlpAttrs []otlpAttr
+
+func (a otlpAttrs) Len() int           { return len(a) }
+func (a otlpAttrs) Less(i, j int) bool { return a[i].Key < a[j].Key }
+func (a otlpAttrs) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// attributes converts tags to sorted attributes
+func attributes(tags map[string]string) []otlpAttr {
+	attrs := make([]otlpAttr, 0, len(tags))
+	for k, v := range tags {
+		attrs = append(attrs, otlpAttr{k, otlpValue{v}})
+	}
+	sort.Sort(otlpAttrs(attrs))
+	return attrs
+}
+
+// otlpNumber sets the value of the data point, returning false
+// for values that are not numeric
+func otlpNumber(p *otlpPoint, value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		p.AsInt = strconv.FormatInt(int64(v), 10)
+	case int32:
+		p.AsInt = strconv.FormatInt(int64(v), 10)
+	case int64:
+		p.AsInt = strconv.FormatInt(v, 10)
+	case uint:
+		return otlpNumber(p, uint64(v))
+	case uint32:
+		p.AsInt = strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		// OTLP ints are signed, and a metric's number type must not
+		// change, so the largest values can't be sent as doubles
+		if v > math.MaxInt64 {
+			return false
+		}
+		p.AsInt = strconv.FormatUint(v, 10)
+	default:
+		f, ok := promFloat(value)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+		p.AsDouble = &f
+	}
+	return true
+}
+
+// otlpMetrics converts the samples into an export request
+func (w *OTLPWriter) otlpMetrics(samples []Sample) otlpRequest {
+	type hostMetrics struct {
+		names   []string
+		metrics map[string]*otlpMetric
+	}
+	hosts := make(map[string]*hostMetrics)
+	var hostNames []string
+	for _, s := range samples {
+		point := otlpPoint{}
+		if !otlpNumber(&point, s.Value) {
+			continue
+		}
+		stop := s.TimeStamp.Stop
+		if stop.IsZero() {
+			stop = time.Now()
+		}
+		point.TimeUnixNano = strconv.FormatInt(stop.UnixNano(), 10)
+
+		tags := make(map[string]string, len(s.Tags))
+		for k, v := range s.Tags {
+			tags[k] = v
+		}
+		host := tags["host"]
+		delete(tags, "host")
+		point.Attributes = attributes(tags)
+
+		h, ok := hosts[host]
+		if !ok {
+			h = &hostMetrics{metrics: make(map[string]*otlpMetric)}
+			hosts[host] = h
+			hostNames = append(hostNames, host)
+		}
+		m, ok := h.metrics[s.Name]
+		if !ok {
+			m = &otlpMetric{Name: s.Name}
+			if info, ok := nameInfo(s.Name); ok {
+				m.Unit = info.Mib.Units
+			}
+			if isCounter(s.Name, s.Value) {
+				m.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			} else {
+				m.Gauge = &otlpGauge{}
+			}
+			h.metrics[s.Name] = m
+			h.names = append(h.names, s.Name)
+		}
+		if m.Sum != nil {
+			// counters started from zero when the agent restarted
+			if ts := s.TimeStamp; ts.Uptime > 0 && !ts.Start.IsZero() {
+				point.StartTimeUnixNano = strconv.FormatInt(ts.Start.Add(-ts.Uptime).UnixNano(), 10)
+			}
+			m.Sum.DataPoints = append(m.Sum.DataPoints, point)
+		} else {
+			m.Gauge.DataPoints = append(m.Gauge.DataPoints, point)
+		}
+	}
+
+	var req otlpRequest
+	for _, host := range hostNames {
+		h := hosts[host]
+		attrs := make(map[string]string, len(w.attrs)+1)
+		for k, v := range w.attrs {
+			attrs[k] = v
+		}
+		if len(host) > 0 {
+			attrs["host.name"] = host
+		}
+		metrics := make([]otlpMetric, 0, len(h.names))
+		for _, name := range h.names {
+			metrics = append(metrics, *h.metrics[name])
+		}
+		req.ResourceMetrics = append(req.ResourceMetrics, otlpResourceMetrics{
+			Resource:     otlpResource{Attributes: attributes(attrs)},
+			ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "snmputil"}, Metrics: metrics}},
+		})
+	}
+	return req
+}
+
+// Send exports the samples. It is a BatchSender, for use with BatchingSender.
+func (w *OTLPWriter) Send(samples []Sample) error {
+	req := w.otlpMetrics(samples)
+	if len(req.ResourceMetrics) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "otlp encode")
+	}
+	r, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "otlp export")
+	}
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		r.Header.Set(k, v)
+	}
+	resp, err := w.Client.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "otlp export")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("otlp export failed (%s): %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// OTLPSender returns a Sender that exports data in batches to an OTLP/HTTP
+// metrics url (e.g., http://localhost:4318/v1/metrics), as described for
+// OTLPWriter. The values of a walk are exported together once the walk
+// is complete, as described for BatchingSender, split per the batch size
+// option. The Batcher should be closed when done to export any remaining data.
+func OTLPSender(url string, opts OTLPOptions) (Sender, *Batcher) {
+	w := NewOTLPWriter(url, opts)
+	return BatchingSender(w.Send, opts.Batch, opts.Idle)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestOTLPSender(t *testing.T) {
+	var got []otlpRequest
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected content type: %s", ct)
+		}
+		auth = r.Header.Get("Authorization")
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = append(got, req)
+	}))
+	defer srv.Close()
+
+	sender, b := OTLPSender(srv.URL+"/v1/metrics", OTLPOptions{
+		Headers:  map[string]string{"Authorization": "Bearer xyz"},
+		Resource: map[string]string{"service.name": "snmp"},
+	})
+	start := time.Unix(1500000000, 0)
+	ts := TimeStamp{Start: start, Stop: start.Add(time.Second), Uptime: time.Hour}
+	tags := map[string]string{"host": "sw1", "column": "Gi1/0/1"}
+	sender("ifHCInOctets", tags, uint64(1000), ts)
+	sender("ifSpeed", tags, uint(1000000000), ts)
+	sender("ifDescr", tags, "uplink", ts)
+	sender("ifHCInOctets", map[string]string{"host": "sw2"}, uint64(2000), ts)
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("expected 1 export, got: %d", len(got))
+	}
+	if auth != "Bearer xyz" {
+		t.Errorf("expected authorization header, got: %q", auth)
+	}
+	rm := got[0].ResourceMetrics
+	if len(rm) != 2 {
+		t.Fatalf("expected 2 resources, got: %+v", rm)
+	}
+	want := []otlpAttr{{"host.name", otlpValue{"sw1"}}, {"service.name", otlpValue{"snmp"}}}
+	if attrs := rm[0].Resource.Attributes; len(attrs) != 2 || attrs[0] != want[0] || attrs[1] != want[1] {
+		t.Errorf("expected resource attributes %v, got: %v", want, attrs)
+	}
+
+	metrics := rm[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("expected 2 metrics (strings skipped), got: %+v", metrics)
+	}
+	sum := metrics[0].Sum
+	if metrics[0].Name != "ifHCInOctets" || sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != otlpCumulative {
+		t.Fatalf("expected cumulative sum for ifHCInOctets, got: %+v", metrics[0])
+	}
+	p := sum.DataPoints[0]
+	boot := strconv.FormatInt(start.Add(-time.Hour).UnixNano(), 10)
+	stop := strconv.FormatInt(ts.Stop.UnixNano(), 10)
+	if p.AsInt != "1000" || p.StartTimeUnixNano != boot || p.TimeUnixNano != stop {
+		t.Errorf("unexpected data point: %+v", p)
+	}
+	if len(p.Attributes) != 1 || p.Attributes[0] != (otlpAttr{"column", otlpValue{"Gi1/0/1"}}) {
+		t.Errorf("expected column attribute only, got: %v", p.Attributes)
+	}
+	gauge := metrics[1].Gauge
+	if metrics[1].Name != "ifSpeed" || gauge == nil || gauge.DataPoints[0].AsInt != "1000000000" {
+		t.Errorf("expected gauge for ifSpeed, got: %+v", metrics[1])
+	}
+	if len(gauge.DataPoints[0].StartTimeUnixNano) > 0 {
+		t.Error("expected no start time for a gauge")
+	}
+}
+
+func TestOTLPNumber(t *testing.T) {
+	// counters keep their number type across their range
+	for _, v := range []uint64{1, math.MaxInt64} {
+		var p otlpPoint
+		if !otlpNumber(&p, v) || p.AsInt != strconv.FormatUint(v, 10) || p.AsDouble != nil {
+			t.Errorf("expected %d as an int, got: %+v", v, p)
+		}
+	}
+	// and values beyond it are skipped rather than faked
+	for _, v := range []uint64{math.MaxInt64 + 1, math.MaxUint64} {
+		var p otlpPoint
+		if otlpNumber(&p, v) {
+			t.Errorf("expected %d to be skipped, got: %+v", v, p)
+		}
+	}
+}
+
+func TestOTLPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad data", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	w := NewOTLPWriter(srv.URL, OTLPOptions{})
+	if err := w.Send([]Sample{{"sysUpTime", nil, 1, TimeStamp{}}}); err == nil {
+		t.Error("expected export error")
+	}
+	if err := w.Send([]Sample{{"sysDescr", nil, "switch", TimeStamp{}}}); err != nil {
+		t.Errorf("expected nothing exported, got: %v", err)
+	}
+}
@@ -6,6 +6,8 @@
 package snmputil
 
 import (
+	"context"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"strings"
@@ -20,8 +22,8 @@ import (
 var (
 	snmpLogger *log.Logger
 
-	// done terminates all polling processes if closed
-	done = make(chan struct{})
+	// quitCtx terminates all Pollers when quit is called
+	quitCtx, quit = context.WithCancel(context.Background())
 
 	// how to break up column indexes with multiple elements
 	multiName = strings.Fields("Grouping Member Element Item")
@@ -38,6 +40,7 @@ const (
 // TimeStamp tracks execution time
 type TimeStamp struct {
 	Start, Stop time.Time
+	Uptime      time.Duration // agent sysUpTime at Start (0 if unknown)
 }
 
 // Sender sends the interpreted PDU value to be saved or whathaveyou
@@ -45,32 +48,51 @@ type Sender func(string, map[string]string, interface{}, TimeStamp) error
 
 // Criteria specifies what to query and what to keep
 type Criteria struct {
-	OID     string            // OID can be dotted string or symbolic name
-	Index   string            // OID of table index
-	Tags    map[string]string // any additional tags to associate
-	Aliases map[string]string // optional column aliases
-	Rename  map[string]string // rename from key to value
-	Regexps []string          // list of regular expressions to filter by name
-	Keep    bool              // Keep matched names if true, discard matches if false
-	OIDTag  bool              // add OID as a tag
-	Suffix  bool              // save suffix portion of OID as tag["suffix"]
-	Count   int               // how many times to poll for data (0 is forever)
-	Freq    int               // how often to poll for data (in seconds)
-	Refresh int               // how often to refresh column data (in seconds)
+	OID      string            // OID can be dotted string or symbolic name
+	OIDs     []string          // OIDs to poll together in place of OID
+	Get      bool              // Get the OIDs (e.g., scalars) rather than walk them
+	Contexts []string          // v3 contexts to poll, overriding the Profile context
+	Index    string            // OID of table index
+	Tags     map[string]string // any additional tags to associate
+	Aliases  map[string]string // optional column aliases
+	Rename   map[string]string // rename from key to value
+	Regexps  []string          // list of regular expressions to filter by name
+	Keep     bool              // Keep matched names if true, discard matches if false
+	OIDTag   bool              // add OID as a tag
+	Suffix   bool              // save suffix portion of OID as tag["suffix"]
+	Count    int               // how many times to poll for data (0 is forever)
+	Freq     int               // how often to poll for data (in seconds)
+	Refresh  int               // how often to refresh column data (in seconds)
+}
+
+// oids returns the OIDs to poll
+func (c Criteria) oids() []string {
+	if len(c.OIDs) > 0 {
+		return c.OIDs
+	}
+	return []string{c.OID}
 }
 
 // ErrFunc processes errors and may be nil if desired
 type ErrFunc func(error)
 
-type avgTime func() int
+// avgTime marks the start of a poll, returning the mean poll time (in ms)
+// and a func to note the agent uptime for the poll
+type avgTime func() (int, func(time.Duration))
 
 // bulkColumns returns a gosnmp.WalkFunc that processes results from a bulkwalk
-func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *log.Logger) (gosnmp.WalkFunc, avgTime, error) {
+func bulkColumns(ctx context.Context, client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *log.Logger) (gosnmp.WalkFunc, avgTime, error) {
 	filter, err := regexpFilter(crit.Regexps, crit.Keep)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// interface info applies to mib-2 OIDs
+	mib2 := false
+	for _, oid := range crit.oids() {
+		mib2 = mib2 || strings.HasPrefix(oid, ".1.3.6.1.2.1")
+	}
+
 	// Interface info
 	columns := make(map[string]string)
 	aliases := make(map[string]string)
@@ -81,14 +103,19 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 	var index string
 	var m, tux sync.Mutex
 	var timer time.Time
+	var uptime time.Duration
+	var sample TimeStamp // shared by all values of a poll
 	times := make([]int, 32)
 	timeIn := 0
 	timeCnt := 0
 
 	started := func(n time.Time) TimeStamp {
 		tux.Lock()
-		t := timer
-		d := int(n.Sub(t).Nanoseconds() / 1000000)
+		defer tux.Unlock()
+		if sample.Stop.IsZero() {
+			sample = TimeStamp{Start: timer, Stop: n, Uptime: uptime}
+		}
+		d := int(n.Sub(timer).Nanoseconds() / 1000000)
 		if timeIn == len(times) {
 			timeIn = 0
 			times[timeIn] = d
@@ -99,22 +126,30 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 				timeCnt++
 			}
 		}
-		tux.Unlock()
-		return TimeStamp{t, n}
+		return sample
 	}
 
-	avg := func() int {
+	// the agent uptime is noted so that counter discontinuities
+	// can be detected
+	setUptime := func(up time.Duration) {
+		tux.Lock()
+		uptime = up
+		tux.Unlock()
+	}
+	avg := func() (int, func(time.Duration)) {
 		tux.Lock()
 		defer tux.Unlock()
 		timer = time.Now()
+		uptime = 0
+		sample = TimeStamp{}
 		if timeCnt == 0 {
-			return 0
+			return 0, setUptime
 		}
 		total := 0
 		for i := 0; i < timeCnt; i++ {
 			total += times[i]
 		}
-		return total / timeCnt
+		return total / timeCnt, setUptime
 	}
 	// get interface column names and aliases
 	suffixValue := func(oid string, lookup map[string]string) error {
@@ -144,7 +179,7 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 		defer m.Unlock()
 
 		// mib-2
-		if strings.HasPrefix(crit.OID, ".1.3.6.1.2.1") {
+		if mib2 {
 			if err := bulkWalker(client, ifOperStatus, opStatus); err != nil {
 				return err
 			}
@@ -177,8 +212,23 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 		return nil
 	}
 
+	// index components of the table of each column, by column OID
+	indexes := make(map[string][]indexPart)
+	columnIndex := func(column string) []indexPart {
+		m.Lock()
+		defer m.Unlock()
+		parts, ok := indexes[column]
+		if !ok {
+			if entry, ok := oidBase[column[:strings.LastIndex(column, ".")]]; ok {
+				parts, _ = entryIndex(entry.Mib)
+			}
+			indexes[column] = parts
+		}
+		return parts
+	}
+
 	// apply tags to resulting value
-	pduTags := func(name, suffix string) (map[string]string, bool) {
+	pduTags := func(name, column, suffix string) (map[string]string, bool) {
 		t := map[string]string{}
 
 		// interface names/aliases only apply to OIDs starting with 'if'
@@ -210,8 +260,18 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 
 		if crit.Suffix {
 			t["suffix"] = suffix
+		} else if parts := columnIndex(column); len(parts) > 0 {
+			// tag each index value by name, per the table INDEX clause
+			values, err := decodeIndex(parts, suffix)
+			if err != nil {
+				t["suffix"] = suffix
+			}
+			for i, v := range values {
+				t[parts[i].Name] = fmt.Sprint(v)
+			}
 		} else {
-			// some oid indexes are composed of multiple words
+			// without MIB index info, guess that indexes are
+			// composed of length prefixed words
 			group := oidStrings(suffix)
 			if len(group) > 0 && len(group[0]) > 0 {
 				t["grouping"] = group[0]
@@ -244,10 +304,16 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 	// to be able to update interface data periodically
 	if crit.Refresh > 0 {
 		go func() {
-			c := time.Tick(time.Duration(crit.Refresh) * time.Second)
-			for range c {
-				if err := columnInfo(); err != nil {
-					logger.Println(errors.Wrap(err, "refresh error"))
+			t := time.NewTicker(time.Duration(crit.Refresh) * time.Second)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					if err := columnInfo(); err != nil {
+						logger.Println(errors.Wrap(err, "refresh error"))
+					}
+				case <-ctx.Done():
+					return
 				}
 			}
 		}()
@@ -264,6 +330,9 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 			for k, v := range crit.Tags {
 				t[k] = v
 			}
+			if len(client.ContextName) > 0 {
+				t["context"] = client.ContextName
+			}
 			return sender(pdu.Name, t, pdu.Value, ts)
 		}
 		subOID := string(sub)
@@ -283,13 +352,16 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 		if len(subOID) < len(pdu.Name) {
 			suffix = pdu.Name[len(subOID)+1:]
 		}
-		t, ok := pduTags(name, suffix)
+		t, ok := pduTags(name, subOID, suffix)
 		if !ok {
 			return nil
 		}
 		if crit.OIDTag {
 			t["oid"] = pdu.Name
 		}
+		if len(client.ContextName) > 0 {
+			t["context"] = client.ContextName
+		}
 
 		value, err := oInfo.Fn(pdu)
 		if err != nil {
@@ -300,6 +372,19 @@ func bulkColumns(client *gosnmp.GoSNMP, crit Criteria, sender Sender, logger *lo
 	}, avg, nil
 }
 
+// pduUptime returns the agent uptime given its sysUpTime, or 0 if invalid
+func pduUptime(pdu gosnmp.SnmpPDU) time.Duration {
+	if pdu.Name != sysUpTime || pdu.Type != gosnmp.TimeTicks {
+		return 0
+	}
+	ticks, err := counter(pdu.Value)
+	if err != nil {
+		return 0
+	}
+	// timeticks are hundredths of a second
+	return time.Duration(ticks) * 10 * time.Millisecond
+}
+
 // bulkWalker applies bulk walk results to fn once all values returned (synchronously)
 func bulkWalker(client *gosnmp.GoSNMP, oid string, fn gosnmp.WalkFunc) error {
 	if len(oid) == 0 {
@@ -314,6 +399,7 @@ func bulkWalker(client *gosnmp.GoSNMP, oid string, fn gosnmp.WalkFunc) error {
 	if err != nil {
 		return err
 	}
+	fn = recording(fn)
 	for _, pdu := range pdus {
 		if err := fn(pdu); err != nil {
 			return err
@@ -322,18 +408,220 @@ func bulkWalker(client *gosnmp.GoSNMP, oid string, fn gosnmp.WalkFunc) error {
 	return nil
 }
 
-// setup preparse the snmp client and returns a walker function to handle bulkwalks
-func setup(p Profile, crit Criteria, sender Sender, logger *log.Logger) (string, *gosnmp.GoSNMP, gosnmp.WalkFunc, avgTime, *log.Logger, error) {
+// walkFunc returns the client's walk method appropriate for its version
+// that applies results to the WalkFunc as they are returned.
+// If up is not nil it is given the agent uptime, fetched with the
+// first request of the walk.
+func walkFunc(client *gosnmp.GoSNMP) func(string, func(time.Duration), gosnmp.WalkFunc) error {
+	// snmp v1 doesn't support bulkwalk
+	walk := client.BulkWalk
+	if client.Version == gosnmp.Version1 {
+		walk = client.Walk
+	}
+	return func(oid string, up func(time.Duration), fn gosnmp.WalkFunc) error {
+		if up != nil {
+			return walkUptime(client, oid, up, recording(fn), walk)
+		}
+		return walk(oid, recording(fn))
+	}
+}
+
+// walkUptime walks the subtree at root as the client walk methods do,
+// but also gets sysUpTime with the first request to save a round trip.
+// The walk is done by walk instead if the agent can't get both.
+func walkUptime(client *gosnmp.GoSNMP, root string, up func(time.Duration), fn gosnmp.WalkFunc, walk func(string, gosnmp.WalkFunc) error) error {
+	reps := client.MaxRepetitions
+	if reps == 0 {
+		reps = 50
+	}
+	oid := root
+	for first := true; ; first = false {
+		oids := []string{oid}
+		if first {
+			// the next OID after the object is its instance
+			oids = []string{strings.TrimSuffix(sysUpTime, ".0"), root}
+		}
+		var resp *gosnmp.SnmpPacket
+		var err error
+		if client.Version == gosnmp.Version1 {
+			resp, err = client.GetNext(oids)
+		} else {
+			resp, err = client.GetBulk(oids, uint8(len(oids)-1), reps)
+		}
+		if err != nil {
+			return err
+		}
+		if resp.Error != gosnmp.NoError || len(resp.Variables) < len(oids) {
+			switch {
+			case first:
+				return walk(root, fn)
+			case resp.Error == gosnmp.NoSuchName && client.Version == gosnmp.Version1:
+				// the end of a v1 agent's MIB
+				return nil
+			case resp.Error != gosnmp.NoError:
+				return errors.Errorf("walk %s: %s", root, resp.Error)
+			}
+			return errors.Errorf("walk %s: no variables after %s", root, oid)
+		}
+		pdus := resp.Variables
+		if first {
+			up(pduUptime(pdus[0]))
+			pdus = pdus[1:]
+		}
+		for i, pdu := range pdus {
+			switch pdu.Type {
+			case gosnmp.EndOfMibView, gosnmp.NoSuchObject, gosnmp.NoSuchInstance:
+				return nil
+			}
+			if !strings.HasPrefix(pdu.Name, root+".") {
+				if first && i == 0 {
+					// root is an instance rather than a subtree
+					return getAll(client, []string{root}, fn)
+				}
+				return nil
+			}
+			if pdu.Name == oid {
+				return errors.Errorf("OID not increasing: %s", oid)
+			}
+			if err := fn(pdu); err != nil {
+				return err
+			}
+		}
+		oid = pdus[len(pdus)-1].Name
+	}
+}
+
+// getAll gets the OIDs in batches and applies the results to fn.
+// Batches are split further if the agent finds them too big,
+// and OIDs unknown to a v1 agent are skipped.
+func getAll(client *gosnmp.GoSNMP, oids []string, fn gosnmp.WalkFunc) error {
+	size := client.MaxOids
+	if size <= 0 {
+		size = gosnmp.MaxOids
+	}
+	for len(oids) > 0 {
+		batch := oids
+		if len(batch) > size {
+			batch = batch[:size]
+		}
+		resp, err := client.Get(batch)
+		if err != nil {
+			return err
+		}
+		switch resp.Error {
+		case gosnmp.NoError:
+		case gosnmp.TooBig:
+			if size == 1 {
+				return errors.Errorf("response too big for %s", batch[0])
+			}
+			size = (size + 1) / 2
+			continue
+		case gosnmp.NoSuchName:
+			i := int(resp.ErrorIndex) - 1
+			if i < 0 || i >= len(batch) {
+				return errors.Errorf("get failed: %v", resp.Error)
+			}
+			// drop the unknown OID and retry the rest
+			oids = append(append([]string{}, oids[:i]...), oids[i+1:]...)
+			continue
+		default:
+			return errors.Errorf("get failed: %v", resp.Error)
+		}
+		for _, pdu := range resp.Variables {
+			switch pdu.Type {
+			case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView, gosnmp.Null:
+				continue
+			}
+			if err := fn(pdu); err != nil {
+				return err
+			}
+		}
+		oids = oids[len(batch):]
+	}
+	return nil
+}
+
+// pollFunc returns a function that polls the OIDs of the criteria
+// and applies the results to a WalkFunc, walking each OID in turn
+// unless they are to be fetched by Get, in each of the criteria contexts.
+// The agent uptime is fetched with the first request of the poll
+// and given to up.
+func pollFunc(client *gosnmp.GoSNMP, crit Criteria) func(gosnmp.WalkFunc, func(time.Duration)) error {
+	oids := crit.oids()
+	walk := walkFunc(client)
+	poll := func(fn gosnmp.WalkFunc, up func(time.Duration)) error {
+		for _, oid := range oids {
+			if err := walk(oid, up, fn); err != nil {
+				return err
+			}
+			up = nil
+		}
+		return nil
+	}
+	if crit.Get {
+		poll = func(fn gosnmp.WalkFunc, up func(time.Duration)) error {
+			fn = recording(fn)
+			if up == nil {
+				return getAll(client, oids, fn)
+			}
+			// sysUpTime may also be one of the OIDs
+			noted := false
+			return getAll(client, append([]string{sysUpTime}, oids...), func(pdu gosnmp.SnmpPDU) error {
+				if !noted && pdu.Name == sysUpTime {
+					noted = true
+					up(pduUptime(pdu))
+					return nil
+				}
+				return fn(pdu)
+			})
+		}
+	}
+	if len(crit.Contexts) == 0 {
+		return poll
+	}
+	return func(fn gosnmp.WalkFunc, up func(time.Duration)) error {
+		orig := client.ContextName
+		defer func() { client.ContextName = orig }()
+		for _, name := range crit.Contexts {
+			client.ContextName = name
+			if err := poll(fn, up); err != nil {
+				return errors.Wrapf(err, "context %s", name)
+			}
+			up = nil
+		}
+		return nil
+	}
+}
+
+// setup preparse the snmp client and returns a walker function to handle bulkwalks,
+// along with the criteria with its OIDs resolved
+func setup(ctx context.Context, p Profile, crit Criteria, sender Sender, logger *log.Logger) (Criteria, *gosnmp.GoSNMP, gosnmp.WalkFunc, avgTime, *log.Logger, error) {
 	client, err := newClient(p)
 	if err != nil {
-		return "", nil, nil, nil, logger, err
+		return crit, nil, nil, nil, logger, err
 	}
-	if crit.OID, err = getOID(crit.OID); err != nil {
-		return crit.OID, nil, nil, nil, logger, err
+	if len(crit.OIDs) > 0 {
+		oids := make([]string, len(crit.OIDs))
+		for i, oid := range crit.OIDs {
+			if oids[i], err = instanceOID(oid); err != nil {
+				return crit, nil, nil, nil, logger, err
+			}
+		}
+		crit.OIDs = oids
+	} else if crit.OID, err = getOID(crit.OID); err != nil {
+		return crit, nil, nil, nil, logger, err
 	}
 	if len(crit.Index) > 0 {
 		if crit.Index, err = getOID(crit.Index); err != nil {
-			return crit.OID, nil, nil, nil, logger, err
+			return crit, nil, nil, nil, logger, err
+		}
+	}
+	if len(crit.Contexts) > 0 && client.Version != gosnmp.Version3 {
+		return crit, nil, nil, nil, logger, errors.New("contexts require snmp v3")
+	}
+	for _, name := range crit.Contexts {
+		if err := validContext(name); err != nil {
+			return crit, nil, nil, nil, logger, err
 		}
 	}
 	if sender == nil {
@@ -343,70 +631,141 @@ func setup(p Profile, crit Criteria, sender Sender, logger *log.Logger) (string,
 		logger = log.New(ioutil.Discard, "", 0)
 	}
 
-	if crit.Tags == nil {
-		crit.Tags = make(map[string]string)
+	// the caller's tags may be shared with other jobs
+	tags := make(map[string]string, len(crit.Tags)+1)
+	for k, v := range crit.Tags {
+		tags[k] = v
 	}
-	crit.Tags["host"] = client.Target
+	tags["host"] = p.Host
+	crit.Tags = tags
 
-	walker, tCtl, err := bulkColumns(client, crit, sender, logger)
-	return crit.OID, client, walker, tCtl, logger, err
+	walker, tCtl, err := bulkColumns(ctx, client, crit, sender, logger)
+	return crit, client, walker, tCtl, logger, err
 }
 
-// Sampler does a single bulkwalk on the device specified using the given Profile
+// Sampler does a single bulkwalk (or get) on the device specified using the given Profile
 func Sampler(p Profile, c Criteria, s Sender) error {
-	oid, client, walker, avg, _, err := setup(p, c, s, nil)
+	c, client, walker, avg, _, err := setup(context.Background(), p, c, s, nil)
 	if err != nil {
 		return err
 	}
-	avg()
+	_, up := avg()
 	defer client.Conn.Close()
-	return bulkWalker(client, oid, walker)
+	return pollFunc(client, c)(walker, up)
+}
+
+// adjustFreq returns the polling delay to use, given the requested
+// frequency, the current delay and the mean response time (in seconds)
+func adjustFreq(freq, delay, mean int) int {
+	if mean > delay {
+		// adjust to next whole minute
+		return ((mean / 60) + 1) * 60
+	}
+	if mean < (delay-60) && delay > freq {
+		// adjust back down if times improve
+		return delay - 60
+	}
+	return delay
 }
 
 // Poller does a bulkwalk on the device specified in the Profile
+// until Quit is called
 func Poller(p Profile, c Criteria, s Sender, fn ErrFunc, l *log.Logger) error {
-	oid, client, walker, avg, l, err := setup(p, c, s, l)
+	return PollerContext(quitCtx, p, c, s, fn, l)
+}
+
+// cancelable wraps the walker so that a walk in progress is aborted
+// when ctx is cancelled. The returned function must be called to release
+// resources once walking is complete.
+func cancelable(ctx context.Context, client *gosnmp.GoSNMP, walker gosnmp.WalkFunc) (gosnmp.WalkFunc, func()) {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblock any pending reads
+			client.Conn.Close()
+		case <-stop:
+		}
+	}()
+	return func(pdu gosnmp.SnmpPDU) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return walker(pdu)
+	}, func() { close(stop) }
+}
+
+// PollerContext does a bulkwalk on the device specified in the Profile
+// until the context is cancelled
+func PollerContext(ctx context.Context, p Profile, c Criteria, s Sender, fn ErrFunc, l *log.Logger) error {
+	c, client, walker, avg, l, err := setup(ctx, p, c, s, l)
 	if err != nil {
 		return err
 	}
+	defer client.Conn.Close()
+
+	walker, release := cancelable(ctx, client, walker)
+	defer release()
 
 	freq := c.Freq
 	delay := freq
-	_, name, ok := rtree.Root().LongestPrefix([]byte(oid))
-	if !ok {
-		name = oid
+	name := strings.Join(c.oids(), ",")
+	if _, v, ok := rtree.Root().LongestPrefix([]byte(c.OID)); ok && len(c.OIDs) == 0 {
+		name = v.(string)
 	}
 
-	// snmp v1 doesn't support bulkwalk
-	walk := client.BulkWalk
-	if p.Version == "1" {
-		walk = client.Walk
+	poll := pollFunc(client, c)
+
+	// like time.Tick, a nil channel (no frequency given) never fires
+	var clk <-chan time.Time
+	var ticker *time.Ticker
+	reset := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, clk = nil, nil
+		}
+		if delay > 0 {
+			ticker = time.NewTicker(time.Duration(delay) * time.Second)
+			clk = ticker.C
+		}
 	}
+	reset()
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
 
-	defer client.Conn.Close()
-	clk := time.Tick(time.Duration(delay) * time.Second)
 	for {
 		// if the last request took longer than the polling frequency
 		// then update the polling frequency to accomodate slower responses
 
 		// stats are in ms but we work in seconds
-		mean := avg() / 1000
+		ms, up := avg()
+		mean := ms / 1000
 		tick := func(adj int) {
 			l.Printf("Adjusting poll for %s/%s from %d to %d seconds (%ds)\n", client.Target, name, delay, adj, mean)
 			delay = adj
-			clk = time.Tick(time.Duration(delay) * time.Second)
+			reset()
 		}
-		if mean > delay {
-			// adjust to next whole minute
-			tick(((mean / 60) + 1) * 60)
+		if adj := adjustFreq(freq, delay, mean); adj > delay {
+			tick(adj)
 			// and pause to sync to new period
-			time.Sleep(time.Duration(delay-mean) * time.Second)
-		} else if mean < (delay-60) && delay > freq {
-			// adjust back down if times improve
-			tick(delay - 60)
+			select {
+			case <-time.After(time.Duration(delay-mean) * time.Second):
+			case <-ctx.Done():
+				return nil
+			}
+		} else if adj < delay {
+			tick(adj)
 		}
 
-		if err = walk(oid, walker); err != nil {
+		err = poll(walker, up)
+		if ctx.Err() != nil {
+			// the walk was aborted, not failed
+			return nil
+		}
+		if err != nil {
 			l.Println(errors.Wrap(err, "snmp walk failed"))
 		}
 
@@ -423,9 +782,9 @@ func Poller(p Profile, c Criteria, s Sender, fn ErrFunc, l *log.Logger) error {
 		}
 
 		select {
-		case _ = <-clk:
+		case <-clk:
 			continue
-		case _ = <-done:
+		case <-ctx.Done():
 			return nil
 		}
 	}
@@ -484,9 +843,11 @@ func NewCollector(mibs string) *Collector {
 	return &Collector{hits: make(map[string]struct{}), valid: rootOID(lookup)}
 }
 
-// Quit exits all active Pollers
+// Quit exits all active Pollers. Pollers started with PollerContext
+// are unaffected and are stopped by cancelling their context.
+// It is safe to call Quit more than once.
 func Quit() {
-	close(done)
+	quit()
 }
 
 // DebugLogger logs all SNMP debug data to the given logger
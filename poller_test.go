@@ -5,10 +5,15 @@
 package snmputil
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
 )
 
 const (
@@ -90,8 +95,473 @@ func TestSample(t *testing.T) {
 	}
 }
 
+func TestPollerContext(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	polled := make(chan struct{}, 1)
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	crit := Criteria{
+		OID:  "system",
+		Tags: testTags,
+		Freq: testFreq,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- PollerContext(ctx, p, crit, sender, nil, logger)
+	}()
+	select {
+	case <-polled:
+	case err := <-errc:
+		t.Fatalf("poller exited early: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no data received from poller")
+	}
+	cancel()
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("poller did not exit after cancel")
+	}
+}
+
 func TestClose(t *testing.T) {
 	// give it a chance to respond with values
 	time.Sleep(5 * time.Second)
 	Quit()
+	// must not panic
+	Quit()
+}
+
+func TestCalcSenderAgent(t *testing.T) {
+	const ifInOctets = ".1.3.6.1.2.1.2.2.1.10.1"
+	a := agentsim.New()
+	a.Set(ifOperStatus+".1", gosnmp.Integer, 1)
+	a.Set(ifName+".1", gosnmp.OctetString, "eth0")
+	a.Set(ifInOctets, gosnmp.Counter32, 1000)
+	a.Step(ifInOctets, 500)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	deltas := []interface{}{}
+	sender := CalcSender(func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		if tags["column"] != "eth0" {
+			t.Errorf("expected column tag of eth0, got: %v", tags)
+		}
+		deltas = append(deltas, value)
+		return nil
+	}, Recipies{"ifInOctets": {}})
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	c := Criteria{OID: "ifInOctets", OIDTag: true}
+	for i := 0; i < 3; i++ {
+		if err := Sampler(p, c, sender); err != nil {
+			t.Fatal(err)
+		}
+		a.Advance(time.Minute)
+	}
+	if len(deltas) != 2 || deltas[0] != uint64(500) || deltas[1] != uint64(500) {
+		t.Errorf("expected 2 deltas of 500, got: %v", deltas)
+	}
+}
+
+func TestCalcSenderReset(t *testing.T) {
+	const ifInOctets = ".1.3.6.1.2.1.2.2.1.10.1"
+	a := agentsim.New()
+	a.Set(ifOperStatus+".1", gosnmp.Integer, 1)
+	a.Set(ifInOctets, gosnmp.Counter32, math.MaxUint32-99)
+	a.Advance(time.Hour)
+	a.Step(ifInOctets, 500)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	deltas := []interface{}{}
+	sender := CalcSender(func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		if ts.Uptime < time.Minute {
+			t.Errorf("expected agent uptime, got: %s", ts.Uptime)
+		}
+		deltas = append(deltas, value)
+		return nil
+	}, Recipies{"ifInOctets": {}})
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	c := Criteria{OID: "ifInOctets", OIDTag: true}
+	sample := func() {
+		if err := Sampler(p, c, sender); err != nil {
+			t.Fatal(err)
+		}
+		a.Advance(time.Minute)
+	}
+
+	// the counter wraps between the first and second samples
+	sample()
+	sample()
+
+	// the sample after the reboot is dropped
+	a.Reboot()
+	a.Advance(time.Minute)
+	sample()
+	sample()
+
+	if len(deltas) != 2 || deltas[0] != uint64(500) || deltas[1] != uint64(500) {
+		t.Errorf("expected 2 deltas of 500, got: %v", deltas)
+	}
+}
+
+func TestPollUptime(t *testing.T) {
+	const ifInOctets = ".1.3.6.1.2.1.2.2.1.10"
+	a := agentsim.New()
+	a.Set(ifInOctets+".1", gosnmp.Counter32, 1)
+	a.Set(ifInOctets+".2", gosnmp.Counter32, 2)
+	a.Set(ifOperStatus+".1", gosnmp.Integer, 1)
+	a.Set(ifOperStatus+".2", gosnmp.Integer, 1)
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Advance(time.Hour)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	// sysUpTime comes with the first request, not a request of its own
+	for _, test := range []struct {
+		version  string
+		crit     Criteria
+		want     int
+		requests int
+	}{
+		{"1", Criteria{OID: ifInOctets}, 2, 3},
+		{"2c", Criteria{OID: ifInOctets}, 2, 1},
+		{"2c", Criteria{OID: "system"}, 2, 1},
+		{"2c", Criteria{OIDs: []string{sysName, sysUpTime}, Get: true}, 2, 1},
+	} {
+		count := 0
+		sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+			count++
+			if ts.Uptime < time.Hour {
+				t.Errorf("v%s %s: expected agent uptime, got: %s", test.version, test.crit.OID, ts.Uptime)
+			}
+			return nil
+		}
+		p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: test.version, Timeout: testTimeout}
+		c, client, walker, avg, _, err := setup(context.Background(), p, test.crit, sender, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := a.Requests()
+		_, up := avg()
+		if err := pollFunc(client, c)(walker, up); err != nil {
+			t.Fatal(err)
+		}
+		if requests := a.Requests() - before; requests != test.requests || count != test.want {
+			t.Errorf("v%s %s: expected %d values in %d requests, got %d in %d", test.version, test.crit.OID, test.want, test.requests, count, requests)
+		}
+		client.Conn.Close()
+	}
+}
+
+func TestPollUptimeError(t *testing.T) {
+	const ifInOctets = ".1.3.6.1.2.1.2.2.1.10"
+	a := agentsim.New()
+	a.Set(ifInOctets+".1", gosnmp.Counter32, 1)
+	a.Set(ifInOctets+".2", gosnmp.Counter32, 2)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "1", Timeout: testTimeout}
+	client, err := newClient(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+
+	// a walk that completes is not an error
+	up := func(time.Duration) {}
+	count := 0
+	if err := walkUptime(client, ifInOctets, up, func(gosnmp.SnmpPDU) error { count++; return nil }, client.Walk); err != nil || count != 2 {
+		t.Fatalf("expected 2 values, got %d (%v)", count, err)
+	}
+
+	// but an error after the first request is
+	fn := func(gosnmp.SnmpPDU) error {
+		a.Fail(1)
+		return nil
+	}
+	if err := walkUptime(client, ifInOctets, up, fn, client.Walk); err == nil {
+		t.Error("expected error for failed request")
+	}
+}
+
+func TestSamplerOIDs(t *testing.T) {
+	const (
+		ifInOctets  = ".1.3.6.1.2.1.2.2.1.10"
+		ifOutOctets = ".1.3.6.1.2.1.2.2.1.16"
+	)
+	a := agentsim.New()
+	for i, name := range []string{"eth0", "eth1"} {
+		suffix := fmt.Sprintf(".%d", i+1)
+		a.Set(ifOperStatus+suffix, gosnmp.Integer, 1)
+		a.Set(ifName+suffix, gosnmp.OctetString, name)
+		a.Set(ifInOctets+suffix, gosnmp.Counter32, 100*(i+1))
+		a.Set(ifOutOctets+suffix, gosnmp.Counter32, 200*(i+1))
+	}
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	got := map[string]interface{}{}
+	stamps := map[TimeStamp]bool{}
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		got[name+"/"+tags["column"]] = value
+		stamps[ts] = true
+		return nil
+	}
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	c := Criteria{OIDs: []string{"ifInOctets", "ifOutOctets"}}
+	if err := Sampler(p, c, sender); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]uint32{
+		"ifInOctets/eth0":  100,
+		"ifInOctets/eth1":  200,
+		"ifOutOctets/eth0": 200,
+		"ifOutOctets/eth1": 400,
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %v, got: %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("expected %s=%d, got: %v", k, v, got[k])
+		}
+	}
+	if len(stamps) != 1 {
+		t.Errorf("expected a single timestamp, got: %v", stamps)
+	}
+}
+
+func TestSamplerContexts(t *testing.T) {
+	const oid = ".1.3.6.1.3.9996.1.0"
+	a := agentsim.New()
+	a.V3 = &gosnmp.UsmSecurityParameters{
+		UserName:                 "user",
+		AuthenticationProtocol:   gosnmp.SHA,
+		AuthenticationPassphrase: "authpass",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privpass",
+	}
+	a.Set(oid, gosnmp.Integer, 1)
+	a.Context("vlan10").Set(oid, gosnmp.Integer, 10)
+	a.Context("vlan20").Set(oid, gosnmp.Integer, 20)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	got := map[string]interface{}{}
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		got[tags["context"]] = value
+		return nil
+	}
+	p := Profile{
+		Host:      "127.0.0.1",
+		Port:      a.Port(),
+		Version:   "3",
+		Timeout:   testTimeout,
+		SecLevel:  "AuthPriv",
+		AuthUser:  "user",
+		AuthPass:  "authpass",
+		AuthProto: "SHA",
+		PrivPass:  "privpass",
+		PrivProto: "AES",
+	}
+	c := Criteria{OID: oid, Get: true, Contexts: []string{"vlan10", "vlan20"}}
+	if err := Sampler(p, c, sender); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["vlan10"] != 10 || got["vlan20"] != 20 {
+		t.Errorf("expected values by context, got: %v", got)
+	}
+
+	// the profile context applies without criteria contexts
+	got = map[string]interface{}{}
+	p.ContextName = "vlan20"
+	if err := Sampler(p, Criteria{OID: oid, Get: true}, sender); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["vlan20"] != 20 {
+		t.Errorf("expected value for vlan20, got: %v", got)
+	}
+
+	for _, test := range []struct {
+		p Profile
+		c Criteria
+	}{
+		{Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", ContextName: "vlan10"}, Criteria{OID: oid}},
+		{Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c"}, Criteria{OID: oid, Contexts: []string{"vlan10"}}},
+		{p, Criteria{OID: oid, Contexts: []string{strings.Repeat("x", 33)}}},
+	} {
+		if err := Sampler(test.p, test.c, sender); err == nil {
+			t.Errorf("expected error for context of %v %v", test.p, test.c)
+		}
+	}
+	p.ContextEngineID = "80001f8804"
+	if _, err := clientConfig(p); err != nil {
+		t.Error(err)
+	}
+	for _, id := range []string{"8000", "not hex"} {
+		p.ContextEngineID = id
+		if _, err := clientConfig(p); err == nil {
+			t.Errorf("expected error for context engine ID: %s", id)
+		}
+	}
+}
+
+func TestCounterDelta(t *testing.T) {
+	if d := counterDelta(uint32(0), 10, math.MaxUint32-9); d != 20 {
+		t.Errorf("expected 32 bit wrap of 20, got: %d", d)
+	}
+	if d := counterDelta(uint64(0), 10, math.MaxUint64-9); d != 20 {
+		t.Errorf("expected 64 bit wrap of 20, got: %d", d)
+	}
+	if d := counterDelta(uint32(0), 30, 10); d != 20 {
+		t.Errorf("expected delta of 20, got: %d", d)
+	}
+}
+
+func TestIndexTags(t *testing.T) {
+	const entry = ".1.3.6.1.3.9999.1.1"
+	for _, m := range []MibInfo{
+		{Name: "TEST-MIB::testTable", OID: ".1.3.6.1.3.9999.1", Syntax: "SEQUENCE OF TestEntry"},
+		{Name: "TEST-MIB::testEntry", OID: entry, Syntax: "TestEntry", Index: "{ testIfIndex, testAddr, IMPLIED testName }"},
+		{Name: "TEST-MIB::testIfIndex", OID: entry + ".1", Syntax: "Integer32", Access: "not-accessible"},
+		{Name: "TEST-MIB::testAddr", OID: entry + ".2", Syntax: "IpAddress", Access: "not-accessible"},
+		{Name: "TEST-MIB::testName", OID: entry + ".3", Syntax: "OCTET STRING (SIZE(0..32))", Access: "not-accessible"},
+		{Name: "TEST-MIB::testCount", OID: entry + ".4", Syntax: "Counter32", Access: "read-only"},
+	} {
+		oidReader(m)
+	}
+
+	a := agentsim.New()
+	a.Set(entry+".4.3.10.0.0.1.101.116.104.48", gosnmp.Counter32, 7)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var tags map[string]string
+	sender := func(name string, t map[string]string, value interface{}, ts TimeStamp) error {
+		tags = t
+		return nil
+	}
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	if err := Sampler(p, Criteria{OID: "testCount"}, sender); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"testIfIndex": "3", "testAddr": "10.0.0.1", "testName": "eth0"} {
+		if tags[k] != v {
+			t.Errorf("expected tag %s=%s, got: %v", k, v, tags)
+		}
+	}
+	if _, ok := tags["grouping"]; ok {
+		t.Errorf("unexpected guessed tags: %v", tags)
+	}
+}
+
+func TestSamplerGet(t *testing.T) {
+	const base = ".1.3.6.1.3.9997"
+	for _, m := range []MibInfo{
+		{Name: "GET-MIB::getCount", OID: base + ".1", Syntax: "Gauge32", Access: "read-only"},
+		{Name: "GET-MIB::getName", OID: base + ".2", Syntax: "OCTET STRING", Hint: "255a", Access: "read-only"},
+		{Name: "GET-MIB::getStatus", OID: base + ".3", Syntax: "INTEGER { up(1), down(2) }", Access: "read-only"},
+	} {
+		oidReader(m)
+	}
+
+	a := agentsim.New()
+	a.Set(base+".1.0", gosnmp.Gauge32, 42)
+	a.Set(base+".2.0", gosnmp.OctetString, "sw1")
+	a.Set(base+".3.0", gosnmp.Integer, 2)
+	a.Set(base+".4.0", gosnmp.Integer, 1) // not polled
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, version := range []string{"1", "2c"} {
+		got := map[string]interface{}{}
+		sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+			got[name] = value
+			return nil
+		}
+		p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: version, Timeout: testTimeout}
+		c := Criteria{
+			OIDs: []string{"getCount.0", "getName.0", base + ".9.0", "getStatus.0"},
+			Get:  true,
+		}
+		if err := Sampler(p, c, sender); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"getCount": uint(42), "getName": "sw1", "getStatus": "down"}
+		if len(got) != len(want) {
+			t.Errorf("v%s expected %v, got: %v", version, want, got)
+		}
+		for k, v := range want {
+			if fmt.Sprint(got[k]) != fmt.Sprint(v) {
+				t.Errorf("v%s expected %s=%v, got: %v", version, k, v, got[k])
+			}
+		}
+	}
+
+	// requests are batched per the max varbinds
+	client := &gosnmp.GoSNMP{
+		Target:    "127.0.0.1",
+		Port:      uint16(a.Port()),
+		Community: "public",
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Second,
+		MaxOids:   2,
+	}
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Conn.Close()
+	before := a.Requests()
+	count := 0
+	err := getAll(client, []string{base + ".1.0", base + ".2.0", base + ".3.0", base + ".4.0", base + ".1.0"}, func(pdu gosnmp.SnmpPDU) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected 5 values, got: %d", count)
+	}
+	if n := a.Requests() - before; n != 3 {
+		t.Errorf("expected 3 requests, got: %d", n)
+	}
+
+	if err := Sampler(Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c"}, Criteria{OIDs: []string{"getCount.0"}}, nil); err == nil {
+		t.Error("expected error for OIDs without Get")
+	}
 }
@@ -0,0 +1,253 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var labelEscape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+type promTarget struct {
+	p    Profile
+	crit Criteria
+}
+
+type promSample struct {
+	name  string
+	kind  string
+	tags  map[string]string
+	value float64
+}
+
+// PrometheusCollector walks its targets each time it is scraped and
+// exposes the results in the Prometheus text exposition format.
+// Counters are exposed as counters, other numbers as gauges, and
+// strings (e.g., enumerations) as info metrics labelled with the value.
+type PrometheusCollector struct {
+	Namespace string // prefix for metric names
+	mu        sync.Mutex
+	targets   []promTarget
+}
+
+// NewPrometheusCollector returns a collector with metrics named
+// with the given namespace prefix (e.g., "snmp")
+func NewPrometheusCollector(namespace string) *PrometheusCollector {
+	return &PrometheusCollector{Namespace: namespace}
+}
+
+// Add includes the device and criteria in each scrape
+func (c *PrometheusCollector) Add(p Profile, crit Criteria) {
+	c.mu.Lock()
+	c.targets = append(c.targets, promTarget{p, crit})
+	c.mu.Unlock()
+}
+
+// promName sanitizes a metric or label name
+func promName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// promFloat converts numeric values, returning false for non-numeric values
+func promFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case time.Time:
+		return float64(v.UnixNano()) / 1e9, true
+	}
+	return 0, false
+}
+
+// isCounter reports whether the value is a counter. The MIB syntax is
+// authoritative, otherwise counters are identified by pduType casting
+// them to unsigned types.
+func isCounter(name string, value interface{}) bool {
+	if info, ok := nameInfo(name); ok && len(info.Mib.Syntax) > 0 {
+		return strings.HasPrefix(info.Mib.Syntax, "Counter")
+	}
+	switch value.(type) {
+	case uint32, uint64:
+		return true
+	}
+	return false
+}
+
+// promSampler returns a sender that converts data into samples
+func (c *PrometheusCollector) promSampler(add func(promSample)) Sender {
+	return func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		metric := promName(name)
+		if len(c.Namespace) > 0 {
+			metric = promName(c.Namespace) + "_" + metric
+		}
+		f, ok := promFloat(value)
+		if !ok {
+			t := make(map[string]string, len(tags)+1)
+			for k, v := range tags {
+				t[k] = v
+			}
+			if b, ok := value.([]byte); ok {
+				value = cleanString(b)
+			}
+			t[name] = fmt.Sprint(value)
+			add(promSample{metric + "_info", "gauge", t, 1})
+			return nil
+		}
+
+		kind := "gauge"
+		if isCounter(name, value) {
+			kind = "counter"
+		}
+		add(promSample{metric, kind, tags, f})
+		return nil
+	}
+}
+
+// Collect walks the targets for host (or all targets if host is empty)
+// and writes the metrics to w
+func (c *PrometheusCollector) Collect(w io.Writer, host string) error {
+	c.mu.Lock()
+	targets := make([]promTarget, 0, len(c.targets))
+	for _, t := range c.targets {
+		if len(host) == 0 || t.p.Host == host {
+			targets = append(targets, t)
+		}
+	}
+	c.mu.Unlock()
+
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	samples := []promSample{}
+	add := func(s promSample) {
+		m.Lock()
+		samples = append(samples, s)
+		m.Unlock()
+	}
+	sender := c.promSampler(add)
+
+	prefix := ""
+	if len(c.Namespace) > 0 {
+		prefix = promName(c.Namespace) + "_"
+	}
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t promTarget) {
+			defer wg.Done()
+			start := time.Now()
+			up := 1.0
+			if err := Sampler(t.p, t.crit, sender); err != nil {
+				up = 0
+			}
+			tags := map[string]string{"host": t.p.Host, "oid": strings.Join(t.crit.oids(), ",")}
+			add(promSample{prefix + "up", "gauge", tags, up})
+			add(promSample{prefix + "scrape_duration_seconds", "gauge", tags, time.Since(start).Seconds()})
+		}(t)
+	}
+	wg.Wait()
+	return writeMetrics(w, samples)
+}
+
+// writeMetrics writes the samples in the text exposition format
+func writeMetrics(w io.Writer, samples []promSample) error {
+	groups := make(map[string][]string)
+	kinds := make(map[string]string)
+	for _, s := range samples {
+		keys := make([]string, 0, len(s.tags))
+		for k := range s.tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, 0, len(keys))
+		for _, k := range keys {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, promName(k), labelEscape.Replace(s.tags[k])))
+		}
+		line := s.name
+		if len(labels) > 0 {
+			line += "{" + strings.Join(labels, ",") + "}"
+		}
+		line += " " + strconv.FormatFloat(s.value, 'g', -1, 64)
+		groups[s.name] = append(groups[s.name], line)
+		kinds[s.name] = s.kind
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := bufio.NewWriter(w)
+	for _, name := range names {
+		lines := groups[name]
+		sort.Strings(lines)
+		fmt.Fprintf(b, "# TYPE %s %s\n", name, kinds[name])
+		for _, line := range lines {
+			fmt.Fprintln(b, line)
+		}
+	}
+	return b.Flush()
+}
+
+// ServeHTTP walks the targets and responds with the metrics.
+// The optional "target" query parameter limits the walk to that host.
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.URL.Query().Get("target")
+	if len(host) > 0 {
+		found := false
+		c.mu.Lock()
+		for _, t := range c.targets {
+			found = found || t.p.Host == host
+		}
+		c.mu.Unlock()
+		if !found {
+			http.Error(w, "unknown target: "+host, http.StatusNotFound)
+			return
+		}
+	}
+	var b bytes.Buffer
+	if err := c.Collect(&b, host); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(b.Bytes())
+}
@@ -0,0 +1,105 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestPrometheusFormat(t *testing.T) {
+	c := NewPrometheusCollector("snmp")
+	samples := []promSample{}
+	sender := c.promSampler(func(s promSample) {
+		samples = append(samples, s)
+	})
+	tags := map[string]string{"host": "sw1", "column": `Gi1/0/1 "uplink"`}
+	var ts TimeStamp
+	sender("ifHCInOctets", tags, uint64(1000), ts)
+	sender("ifInErrors", tags, uint32(3), ts)
+	sender("ifSpeed", tags, uint(1000000000), ts)
+	sender("ifOperStatus", tags, "up", ts)
+	sender("ifHCInOctets", map[string]string{"host": "sw1", "column": "Gi1/0/2"}, uint64(2000), ts)
+
+	var b bytes.Buffer
+	if err := writeMetrics(&b, samples); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE snmp_ifHCInOctets counter
+snmp_ifHCInOctets{column="Gi1/0/1 \"uplink\"",host="sw1"} 1000
+snmp_ifHCInOctets{column="Gi1/0/2",host="sw1"} 2000
+# TYPE snmp_ifInErrors counter
+snmp_ifInErrors{column="Gi1/0/1 \"uplink\"",host="sw1"} 3
+# TYPE snmp_ifOperStatus_info gauge
+snmp_ifOperStatus_info{column="Gi1/0/1 \"uplink\"",host="sw1",ifOperStatus="up"} 1
+# TYPE snmp_ifSpeed gauge
+snmp_ifSpeed{column="Gi1/0/1 \"uplink\"",host="sw1"} 1e+09
+`
+	if got := b.String(); got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestPrometheusUnknownTarget(t *testing.T) {
+	c := NewPrometheusCollector("snmp")
+	c.Add(profileV2, Criteria{OID: "system"})
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics?target=no.such.host", nil))
+	if w.Code != 404 {
+		t.Errorf("expected 404 for unknown target, got %d", w.Code)
+	}
+}
+
+func TestPrometheusScrape(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Set(sysUpTime, gosnmp.TimeTicks, 100)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	c := NewPrometheusCollector("snmp")
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	c.Add(p, Criteria{OID: "system", Tags: map[string]string{"site": "lab"}})
+	c.Add(p, Criteria{OIDs: []string{sysName, sysUpTime}, Get: true})
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	// overlapping scrapes poll the same target at once
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL + "/metrics?target=127.0.0.1")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+			body := string(b)
+			for _, want := range []string{
+				`snmp_sysName_info{host="127.0.0.1",site="lab",sysName="sw1"} 1`,
+				`snmp_up{host="127.0.0.1",oid="system"} 1`,
+				`snmp_up{host="127.0.0.1",oid="` + sysName + `,` + sysUpTime + `"} 1`,
+			} {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected %s in:\n%s", want, body)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
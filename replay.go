@@ -0,0 +1,221 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+// replayScheme is the Profile.Host prefix that specifies a recording
+// to replay rather than a device to poll, e.g., "file://walk.snmprec"
+const replayScheme = "file://"
+
+var (
+	recorder *Recorder
+	recordMu sync.Mutex
+
+	// replay agents, by filename and v3 user
+	replays  = make(map[string]*replay)
+	replayMu sync.Mutex
+)
+
+// Recorder captures walked PDUs in snmprec format so they can be replayed
+type Recorder struct {
+	sync.Mutex
+	lines map[string]string // by OID
+}
+
+// NewRecorder returns an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{lines: make(map[string]string)}
+}
+
+// Record saves all PDUs subsequently walked to the Recorder.
+// Recording is stopped if r is nil.
+func Record(r *Recorder) {
+	recordMu.Lock()
+	recorder = r
+	recordMu.Unlock()
+}
+
+// recording returns a WalkFunc that records PDUs before processing them
+func recording(fn gosnmp.WalkFunc) gosnmp.WalkFunc {
+	recordMu.Lock()
+	r := recorder
+	recordMu.Unlock()
+	if r == nil {
+		return fn
+	}
+	return func(pdu gosnmp.SnmpPDU) error {
+		r.Add(pdu)
+		return fn(pdu)
+	}
+}
+
+// Add records the PDU, replacing any prior value for its OID
+func (r *Recorder) Add(pdu gosnmp.SnmpPDU) {
+	line, ok := agentsim.FormatRecord(pdu)
+	if !ok {
+		return
+	}
+	r.Lock()
+	r.lines[strings.TrimPrefix(pdu.Name, ".")] = line
+	r.Unlock()
+}
+
+// WriteTo writes the recorded PDUs to w in snmprec format, ordered by OID
+func (r *Recorder) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	list := make([]recEntry, 0, len(r.lines))
+	for oid, line := range r.lines {
+		list = append(list, recEntry{Octets(oid), line})
+	}
+	r.Unlock()
+	sort.Sort(recEntries(list))
+
+	var total int64
+	b := bufio.NewWriter(w)
+	for _, e := range list {
+		n, err := fmt.Fprintln(b, e.line)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, b.Flush()
+}
+
+// Save writes the recorded PDUs to the named file
+func (r *Recorder) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := r.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+type recEntry struct {
+	oid  []int
+	line string
+}
+
+type recEntries []recEntry
+
+func (r recEntries) Len() int      { return len(r) }
+func (r recEntries) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r recEntries) Less(i, j int) bool {
+	a, b := r[i].oid, r[j].oid
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// replay is an agent replaying a recording for its clients
+type replay struct {
+	agent *agentsim.Agent
+	refs  int
+}
+
+// replayConn releases its replay agent when closed
+type replayConn struct {
+	net.Conn
+	release func()
+}
+
+func (c replayConn) Close() error {
+	c.release()
+	return c.Conn.Close()
+}
+
+// replayAgent returns the running agent for the recording, which serves
+// the v3 user if not nil, and a func to release it. The agent is closed
+// once all of its clients have released it.
+func replayAgent(filename string, v3 *gosnmp.UsmSecurityParameters) (*agentsim.Agent, func(), error) {
+	key := filename
+	if v3 != nil {
+		key = fmt.Sprintf("%s|%s|%d|%s|%d|%s", filename, v3.UserName, v3.AuthenticationProtocol,
+			v3.AuthenticationPassphrase, v3.PrivacyProtocol, v3.PrivacyPassphrase)
+	}
+
+	replayMu.Lock()
+	defer replayMu.Unlock()
+	r, ok := replays[key]
+	if !ok {
+		a := agentsim.New()
+		a.V3 = v3
+		if err := a.Load(filename); err != nil {
+			return nil, nil, err
+		}
+		if err := a.Listen("127.0.0.1:0"); err != nil {
+			return nil, nil, err
+		}
+		r = &replay{agent: a}
+		replays[key] = r
+	}
+	r.refs++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			replayMu.Lock()
+			defer replayMu.Unlock()
+			r.refs--
+			if r.refs == 0 {
+				delete(replays, key)
+				r.agent.Close()
+			}
+		})
+	}
+	return r.agent, release, nil
+}
+
+// replayClient returns a client connected to an agent replaying the
+// recording named by the Profile Host, using the Profile security settings
+func replayClient(p Profile) (*gosnmp.GoSNMP, error) {
+	client, err := clientConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	var v3 *gosnmp.UsmSecurityParameters
+	if params, ok := client.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+		// the client's copy is updated by discovery
+		v3 = &gosnmp.UsmSecurityParameters{
+			UserName:                 params.UserName,
+			AuthenticationProtocol:   params.AuthenticationProtocol,
+			AuthenticationPassphrase: params.AuthenticationPassphrase,
+			PrivacyProtocol:          params.PrivacyProtocol,
+			PrivacyPassphrase:        params.PrivacyPassphrase,
+		}
+	}
+	a, release, err := replayAgent(strings.TrimPrefix(p.Host, replayScheme), v3)
+	if err != nil {
+		return nil, err
+	}
+	client.Target = "127.0.0.1"
+	client.Port = uint16(a.Port())
+	if err := client.Connect(); err != nil {
+		release()
+		return nil, err
+	}
+	client.Conn = replayConn{client.Conn, release}
+	return client, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soniah/gosnmp"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snmprec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewRecorder()
+	for _, pdu := range []gosnmp.SnmpPDU{
+		{Name: ".1.3.6.1.2.1.1.5.0", Type: gosnmp.OctetString, Value: []byte("sw1")},
+		{Name: ".1.3.6.1.2.1.1.1.0", Type: gosnmp.OctetString, Value: []byte("test|switch")},
+		{Name: ".1.3.6.1.2.1.1.2.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.4.1.9.1.1"},
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(123456)},
+		{Name: ".1.3.6.1.2.1.1.10.0", Type: gosnmp.OctetString, Value: []byte{0, 1, 0xfe}},
+		{Name: ".1.3.6.1.2.1.2.1.0", Type: gosnmp.Integer, Value: 2},
+	} {
+		r.Add(pdu)
+	}
+	filename := filepath.Join(dir, "walk.snmprec")
+	if err := r.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := ioutil.ReadFile(filename)
+	want := `1.3.6.1.2.1.1.1.0|4|test|switch
+1.3.6.1.2.1.1.2.0|6|1.3.6.1.4.1.9.1.1
+1.3.6.1.2.1.1.3.0|67|123456
+1.3.6.1.2.1.1.5.0|4|sw1
+1.3.6.1.2.1.1.10.0|4x|0001fe
+1.3.6.1.2.1.2.1.0|2|2
+`
+	if string(saved) != want {
+		t.Fatalf("expected:\n%s\ngot:\n%s", want, saved)
+	}
+
+	// replaying the subtree should record it exactly as saved
+	again := NewRecorder()
+	Record(again)
+	defer Record(nil)
+
+	count := 0
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		count++
+		return nil
+	}
+	p := Profile{Host: "file://" + filename, Version: "2c", Timeout: 1}
+	if err := Sampler(p, Criteria{OID: ".1.3.6.1.2.1.1"}, sender); err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected 5 values, got: %d", count)
+	}
+	var b bytes.Buffer
+	again.WriteTo(&b)
+	if got, want := b.String(), want[:len(want)-len("1.3.6.1.2.1.2.1.0|2|2\n")]; got != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, got)
+	}
+
+	// agents are closed once their clients are
+	replayMu.Lock()
+	if len(replays) > 0 {
+		t.Errorf("expected replay agents to be closed, got: %v", replays)
+	}
+	replayMu.Unlock()
+
+	// v3 profiles are replayed with their security settings
+	Record(nil)
+	count = 0
+	v3 := Profile{
+		Host:      p.Host,
+		Version:   "3",
+		Timeout:   1,
+		SecLevel:  "AuthPriv",
+		AuthUser:  "user",
+		AuthPass:  "authpass",
+		AuthProto: "SHA",
+		PrivPass:  "privpass",
+		PrivProto: "AES",
+	}
+	if err := Sampler(v3, Criteria{OID: ".1.3.6.1.2.1.1"}, sender); err != nil {
+		t.Fatal(err)
+	}
+	if count != 5 {
+		t.Errorf("expected 5 v3 values, got: %d", count)
+	}
+	v3.PrivProto = "AES512"
+	if err := Sampler(v3, Criteria{OID: ".1.3.6.1.2.1.1"}, sender); err == nil {
+		t.Error("expected error for invalid v3 profile")
+	}
+
+	p.Host = "file://" + filepath.Join(dir, "missing.snmprec")
+	if err := Sampler(p, Criteria{OID: ".1.3.6.1.2.1.1"}, sender); err == nil {
+		t.Error("expected error for missing recording")
+	}
+}
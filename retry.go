@@ -0,0 +1,259 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryOptions control how a RetrySender retries
+type RetryOptions struct {
+	Retries   int              // retries after the first attempt (default 3)
+	Delay     time.Duration    // delay before the first retry, doubled each retry (default 100ms)
+	MaxDelay  time.Duration    // longest delay between retries (default 10s)
+	Spool     string           // file to append undeliverable samples to (optional)
+	Transient func(error) bool // reports errors worth retrying (default is all errors)
+	Context   context.Context  // retrying stops once it is done (default is until Quit)
+}
+
+// spooled is a sample as saved in a spool file, with the type
+// of the value so that it can be restored
+type spooled struct {
+	Sample
+	Type string
+}
+
+// spoolMu serializes writes to spool files
+var spoolMu sync.Mutex
+
+// spool appends the samples to the file as JSON lines
+func spool(path string, samples ...Sample) error {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "spool open")
+	}
+	enc := json.NewEncoder(f)
+	for _, s := range samples {
+		if err = enc.Encode(spooled{s, fmt.Sprintf("%T", s.Value)}); err != nil {
+			break
+		}
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return errors.Wrap(err, "spool write")
+}
+
+// RetrySender returns a Sender that retries failed sends with exponential
+// backoff. Samples still failing once retries are exhausted, or failing
+// with an error that is not transient, are appended to the spool file
+// (if set) to be replayed later with ReplaySpool. The error is returned
+// if the sample could not be spooled. As retries delay the caller, use
+// with an AsyncSender to avoid slowing polling. Once the Context is done
+// failed samples are no longer retried, but are still spooled.
+func RetrySender(sender Sender, opts RetryOptions) Sender {
+	if opts.Retries <= 0 {
+		opts.Retries = 3
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = 100 * time.Millisecond
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 10 * time.Second
+	}
+	if opts.Context == nil {
+		opts.Context = quitCtx
+	}
+	return func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		delay := opts.Delay
+		err := sender(name, tags, value, ts)
+	retry:
+		for i := 0; err != nil && i < opts.Retries; i++ {
+			if opts.Transient != nil && !opts.Transient(err) {
+				break
+			}
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-opts.Context.Done():
+				t.Stop()
+				break retry
+			}
+			if delay *= 2; delay > opts.MaxDelay {
+				delay = opts.MaxDelay
+			}
+			err = sender(name, tags, value, ts)
+		}
+		if err == nil || len(opts.Spool) == 0 {
+			return err
+		}
+		if e := spool(opts.Spool, Sample{name, tags, value, ts}); e != nil {
+			return errors.Wrapf(e, "sample lost (%v)", err)
+		}
+		return nil
+	}
+}
+
+// spoolValue restores a value decoded from a spool file to its original type
+func spoolValue(typ string, v interface{}) (interface{}, error) {
+	n, ok := v.(json.Number)
+	if !ok {
+		if s, ok := v.(string); ok {
+			switch typ {
+			case "[]uint8":
+				return base64.StdEncoding.DecodeString(s)
+			case "time.Time":
+				return time.Parse(time.RFC3339Nano, s)
+			}
+		}
+		return v, nil
+	}
+	s := n.String()
+	switch typ {
+	case "time.Duration":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return time.Duration(i), err
+	case "int":
+		i, err := strconv.ParseInt(s, 10, 0)
+		return int(i), err
+	case "int32":
+		i, err := strconv.ParseInt(s, 10, 32)
+		return int32(i), err
+	case "int64":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint":
+		u, err := strconv.ParseUint(s, 10, 0)
+		return uint(u), err
+	case "uint32":
+		u, err := strconv.ParseUint(s, 10, 32)
+		return uint32(u), err
+	case "uint64":
+		return strconv.ParseUint(s, 10, 64)
+	case "float32":
+		f, err := strconv.ParseFloat(s, 32)
+		return float32(f), err
+	}
+	return n.Float64()
+}
+
+// moveSpool moves the spool file to the replay file, appending it to
+// any replay file left by a replay that was cut short
+func moveSpool(path, replay string) error {
+	spoolMu.Lock()
+	defer spoolMu.Unlock()
+	if _, err := os.Stat(replay); os.IsNotExist(err) {
+		return os.Rename(path, replay)
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		// only the leftover samples to replay
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(replay, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// rewriteReplay replaces the replay file with just the samples
+func rewriteReplay(replay string, samples []Sample) error {
+	tmp := replay + ".tmp"
+	os.Remove(tmp)
+	if err := spool(tmp, samples...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, replay)
+}
+
+// ReplaySpool sends the samples saved in a spool file to sender.
+// Samples that fail again are appended back to the spool, so it is
+// safe to replay while a RetrySender is still spooling to it.
+// Samples left by a replay that was cut short are replayed as well.
+func ReplaySpool(path string, sender Sender) error {
+	replay := path + ".replay"
+	if err := moveSpool(path, replay); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "spool replay")
+	}
+	f, err := os.Open(replay)
+	if err != nil {
+		return errors.Wrap(err, "spool replay")
+	}
+	defer f.Close()
+
+	var failed []Sample
+	var last error
+	total, bad := 0, 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		total++
+		var s spooled
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		err := dec.Decode(&s)
+		if err == nil {
+			s.Value, err = spoolValue(s.Type, s.Value)
+		}
+		if err != nil {
+			// a corrupt line cannot be sent, so it is dropped
+			bad++
+			last = errors.Wrapf(err, "spool line %d", total)
+			continue
+		}
+		if err := sender(s.Name, s.Tags, s.Value, s.TimeStamp); err != nil {
+			failed = append(failed, s.Sample)
+			last = err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "spool replay")
+	}
+	f.Close()
+	if len(failed) > 0 {
+		if err := spool(path, failed...); err != nil {
+			// keep only the undelivered samples for the next replay
+			if e := rewriteReplay(replay, failed); e != nil {
+				return errors.Wrapf(err, "%d delivered samples will be replayed again", total-bad-len(failed))
+			}
+			return err
+		}
+	}
+	if err := os.Remove(replay); err != nil {
+		return errors.Wrap(err, "spool replay")
+	}
+	if last != nil {
+		return errors.Wrapf(last, "%d of %d samples not replayed", len(failed)+bad, total)
+	}
+	return nil
+}
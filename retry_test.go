@@ -0,0 +1,182 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRetrySender(t *testing.T) {
+	tries := 0
+	flaky := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		if tries++; tries < 3 {
+			return fmt.Errorf("try %d failed", tries)
+		}
+		return nil
+	}
+	sender := RetrySender(flaky, RetryOptions{Delay: time.Millisecond})
+	if err := sender("a", nil, 1, TimeStamp{}); err != nil {
+		t.Fatal(err)
+	}
+	if tries != 3 {
+		t.Errorf("expected 3 tries, got: %d", tries)
+	}
+
+	// permanent errors are not retried
+	tries = 0
+	failing := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		tries++
+		return fmt.Errorf("rejected")
+	}
+	sender = RetrySender(failing, RetryOptions{
+		Delay:     time.Millisecond,
+		Transient: func(error) bool { return false },
+	})
+	if err := sender("a", nil, 1, TimeStamp{}); err == nil {
+		t.Error("expected error without spool")
+	}
+	if tries != 1 {
+		t.Errorf("expected 1 try, got: %d", tries)
+	}
+
+	// retrying stops once the context is done
+	tries = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	sender = RetrySender(func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		tries++
+		cancel()
+		return fmt.Errorf("down")
+	}, RetryOptions{Delay: time.Hour, Context: ctx})
+	if err := sender("a", nil, 1, TimeStamp{}); err == nil {
+		t.Error("expected error once cancelled")
+	}
+	if tries != 1 {
+		t.Errorf("expected 1 try, got: %d", tries)
+	}
+}
+
+func TestReplaySpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead.json")
+
+	down := true
+	var got []string
+	backend := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		if down {
+			return fmt.Errorf("backend down")
+		}
+		got = append(got, fmt.Sprintf("%s=%v(%T) %v %d", name, value, value, tags, ts.Uptime))
+		return nil
+	}
+	sender := RetrySender(backend, RetryOptions{Retries: 2, Delay: time.Millisecond, Spool: path})
+	tags := map[string]string{"host": "sw1"}
+	ts := TimeStamp{Start: time.Now(), Stop: time.Now(), Uptime: time.Hour}
+	when := time.Date(2016, 6, 1, 12, 0, 0, 5, time.UTC)
+	for _, v := range []interface{}{uint32(7), uint64(1 << 40), int64(-3), 2.5, "up", []byte{0, 1, 2}, when, time.Second} {
+		if err := sender("v", tags, v, ts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got) > 0 {
+		t.Fatalf("expected no data delivered, got: %v", got)
+	}
+
+	// still down, so all are returned to the spool
+	if err := ReplaySpool(path, backend); err == nil {
+		t.Error("expected replay error")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected samples to be respooled: %v", err)
+	}
+
+	down = false
+	if err := ReplaySpool(path, backend); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"v=7(uint32) map[host:sw1] 3600000000000",
+		"v=1099511627776(uint64) map[host:sw1] 3600000000000",
+		"v=-3(int64) map[host:sw1] 3600000000000",
+		"v=2.5(float64) map[host:sw1] 3600000000000",
+		"v=up(string) map[host:sw1] 3600000000000",
+		"v=[0 1 2]([]uint8) map[host:sw1] 3600000000000",
+		"v=2016-06-01 12:00:00.000000005 +0000 UTC(time.Time) map[host:sw1] 3600000000000",
+		"v=1s(time.Duration) map[host:sw1] 3600000000000",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got: %v", want, got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected spool to be removed, got: %v", err)
+	}
+	if err := ReplaySpool(path, backend); err != nil {
+		t.Errorf("expected no error replaying missing spool, got: %v", err)
+	}
+
+	// samples left by a replay that was cut short are kept
+	got = nil
+	down = true
+	sender("left", tags, 1, ts)
+	if err := os.Rename(path, path+".replay"); err != nil {
+		t.Fatal(err)
+	}
+	sender("new", tags, 2, ts)
+	down = false
+	if err := ReplaySpool(path, backend); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"left=1(int) map[host:sw1] 3600000000000",
+		"new=2(int) map[host:sw1] 3600000000000",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got: %v", want, got)
+	}
+	if _, err := os.Stat(path + ".replay"); !os.IsNotExist(err) {
+		t.Errorf("expected replay file to be removed, got: %v", err)
+	}
+
+	// if failures can't be respooled, only they are left to replay
+	got = nil
+	down = true
+	for _, name := range []string{"ok", "fail"} {
+		sender(name, tags, 1, ts)
+	}
+	down = false
+	flaky := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		if name == "fail" {
+			// the spool can no longer be written
+			os.Mkdir(path, 0755)
+			return fmt.Errorf("backend down")
+		}
+		return backend(name, tags, value, ts)
+	}
+	if err := ReplaySpool(path, flaky); err == nil {
+		t.Error("expected replay error")
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReplaySpool(path, backend); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"ok=1(int) map[host:sw1] 3600000000000",
+		"fail=1(int) map[host:sw1] 3600000000000",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got: %v", want, got)
+	}
+}
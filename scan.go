@@ -0,0 +1,109 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Probe returns the identity of the device specified by the Profile
+func Probe(p Profile) (Identity, error) {
+	client, err := newClient(p)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer client.Conn.Close()
+	return identify(client)
+}
+
+// Scanner probes ranges of addresses for SNMP devices
+type Scanner struct {
+	Discoverer     // how each address is probed
+	Workers    int // number of concurrent probes (default is 64)
+}
+
+// addresses returns the host addresses of a CIDR range, or the
+// address itself if not a range
+func addresses(cidr string) ([]string, error) {
+	if !strings.Contains(cidr, "/") {
+		return []string{cidr}, nil
+	}
+	ip, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if ip = ip.To4(); ip == nil {
+		return nil, errors.Errorf("only IPv4 ranges are supported: %s", cidr)
+	}
+	ones, bits := ipnet.Mask.Size()
+	if bits-ones > 24 {
+		return nil, errors.Errorf("range is too large: %s", cidr)
+	}
+	start := uint32(ipnet.IP[0])<<24 | uint32(ipnet.IP[1])<<16 | uint32(ipnet.IP[2])<<8 | uint32(ipnet.IP[3])
+	count := uint32(1) << uint(bits-ones)
+	addrs := make([]string, 0, count)
+	for i := uint32(0); i < count; i++ {
+		// skip the network and broadcast addresses of subnets
+		if count > 2 && (i == 0 || i == count-1) {
+			continue
+		}
+		n := start + i
+		addrs = append(addrs, net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).String())
+	}
+	return addrs, nil
+}
+
+// Scan probes each address of the CIDR ranges (or single hosts) with the
+// candidate profiles and calls fn with the working profile and identity of
+// each device found. Calls to fn are not concurrent.
+func (s Scanner) Scan(cidrs []string, candidates []Profile, fn func(Profile, Identity)) error {
+	hosts := []string{}
+	for _, cidr := range cidrs {
+		addrs, err := addresses(cidr)
+		if err != nil {
+			return err
+		}
+		hosts = append(hosts, addrs...)
+	}
+	workers := s.Workers
+	if workers <= 0 {
+		workers = 64
+	}
+
+	type found struct {
+		p  Profile
+		id Identity
+	}
+	queue := make(chan string)
+	results := make(chan found)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range queue {
+				if p, id, err := s.Discover(host, candidates); err == nil {
+					results <- found{p, id}
+				}
+			}
+		}()
+	}
+	go func() {
+		for _, host := range hosts {
+			queue <- host
+		}
+		close(queue)
+		wg.Wait()
+		close(results)
+	}()
+	for r := range results {
+		fn(r.p, r.id)
+	}
+	return nil
+}
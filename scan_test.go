@@ -0,0 +1,81 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestAddresses(t *testing.T) {
+	for cidr, want := range map[string]string{
+		"10.0.0.0/30":   "10.0.0.1 10.0.0.2",
+		"10.0.0.8/31":   "10.0.0.8 10.0.0.9",
+		"10.0.0.7/32":   "10.0.0.7",
+		"10.0.0.255/29": "10.0.0.249 10.0.0.250 10.0.0.251 10.0.0.252 10.0.0.253 10.0.0.254",
+		"sw1.example":   "sw1.example",
+	} {
+		addrs, err := addresses(cidr)
+		if err != nil {
+			t.Errorf("%s: %v", cidr, err)
+			continue
+		}
+		if got := strings.Join(addrs, " "); got != want {
+			t.Errorf("%s expected %s, got: %s", cidr, want, got)
+		}
+	}
+	for _, cidr := range []string{"10.0.0.0/33", "10.0.0.0/4", "::1/128"} {
+		if _, err := addresses(cidr); err == nil {
+			t.Errorf("expected error for %s", cidr)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	a := agentsim.New()
+	a.Community = "private"
+	a.Set(sysDescr, gosnmp.OctetString, "simulated switch")
+	a.Set(sysObjectID, gosnmp.ObjectIdentifier, ".1.3.6.1.4.1.9.1.1")
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	a.Set(sysLocation, gosnmp.OctetString, "rack 1")
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	id, err := Probe(Profile{Host: "127.0.0.1", Port: a.Port(), Community: "private", Timeout: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "sw1" || id.Location != "rack 1" {
+		t.Errorf("unexpected identity: %+v", id)
+	}
+
+	candidates := []Profile{
+		{Port: a.Port(), Version: "2c", Community: "public"},
+		{Port: a.Port(), Version: "2c", Community: "private"},
+	}
+	found := map[string]Profile{}
+	s := Scanner{Workers: 4}
+	err = s.Scan([]string{"127.0.0.0/30"}, candidates, func(p Profile, id Identity) {
+		if id.Name != "sw1" {
+			t.Errorf("unexpected identity: %+v", id)
+		}
+		found[p.Host] = p
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := found["127.0.0.1"]; len(found) != 1 || !ok || p.Community != "private" {
+		t.Errorf("expected 127.0.0.1 with community private, got: %v", found)
+	}
+
+	if err := s.Scan([]string{"127.0.0.0/40"}, candidates, nil); err == nil {
+		t.Error("expected error for invalid range")
+	}
+}
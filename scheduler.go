@@ -0,0 +1,353 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"container/heap"
+	"context"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+// JobInfo describes the current state of a scheduled job
+type JobInfo struct {
+	ID    string    // job identifier returned by Add or AddJob
+	Host  string    // host being polled
+	OID   string    // OID being walked (or OIDs polled)
+	Freq  int       // current polling frequency (in seconds)
+	Runs  int       // number of completed walks
+	Last  time.Time // when the last walk started
+	Next  time.Time // when the next walk is due
+	Error error     // result of the last walk
+}
+
+// job is a Profile and Criteria pair being polled by a Scheduler
+type job struct {
+	JobInfo
+	count   int
+	freq    int
+	client  *gosnmp.GoSNMP
+	poll    func(gosnmp.WalkFunc, func(time.Duration)) error
+	walker  gosnmp.WalkFunc
+	avg     avgTime
+	cancel  func()
+	removed bool
+	pos     int // position in queue, -1 if not queued
+}
+
+// jobQueue is a heap of jobs ordered by when they are next due
+type jobQueue []*job
+
+func (q jobQueue) Len() int           { return len(q) }
+func (q jobQueue) Less(i, j int) bool { return q[i].Next.Before(q[j].Next) }
+func (q jobQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].pos = i
+	q[j].pos = j
+}
+
+func (q *jobQueue) Push(x interface{}) {
+	j := x.(*job)
+	j.pos = len(*q)
+	*q = append(*q, j)
+}
+
+func (q *jobQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	j.pos = -1
+	*q = old[:n-1]
+	return j
+}
+
+// Scheduler polls many devices using a bounded pool of workers
+// rather than a goroutine per device
+type Scheduler struct {
+	workers int
+	jitter  time.Duration
+	errFn   ErrFunc
+	logger  *log.Logger
+
+	mu    sync.Mutex
+	ctx   context.Context
+	jobs  map[string]*job
+	queue jobQueue
+	wake  chan struct{}
+}
+
+// NewScheduler returns a Scheduler that walks with up to workers concurrent
+// requests. The first walk of each job is delayed by a random amount up to
+// jitter so that requests are spread out rather than all starting at once.
+// If workers is less than 1 the number of CPUs is used.
+func NewScheduler(workers int, jitter time.Duration, fn ErrFunc, logger *log.Logger) *Scheduler {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	return &Scheduler{
+		workers: workers,
+		jitter:  jitter,
+		errFn:   fn,
+		logger:  logger,
+		ctx:     context.Background(),
+		jobs:    make(map[string]*job),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// jobID returns the identifier for a Profile and Criteria pair
+func jobID(p Profile, c Criteria) string {
+	return p.Host + "/" + strings.Join(c.oids(), ",")
+}
+
+// signal wakes the dispatcher to recheck the queue
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Add schedules polling of the device in the Profile using the Criteria
+// and returns the id of the job, which is made from the host and OIDs
+func (s *Scheduler) Add(p Profile, c Criteria, sender Sender) (string, error) {
+	return s.AddJob(jobID(p, c), p, c, sender)
+}
+
+// AddJob is like Add but uses the given id for the job, so that
+// a device can be polled for the same OIDs in more than one way
+func (s *Scheduler) AddJob(id string, p Profile, c Criteria, sender Sender) (string, error) {
+	if c.Freq < 1 && c.Count != 1 {
+		return id, errors.Errorf("invalid polling frequency %d for job: %s", c.Freq, id)
+	}
+	s.mu.Lock()
+	_, ok := s.jobs[id]
+	parent := s.ctx
+	s.mu.Unlock()
+	if ok {
+		return id, errors.Errorf("job already scheduled: %s", id)
+	}
+
+	ctx, cancel := context.WithCancel(parent)
+	c, client, walker, avg, _, err := setup(ctx, p, c, sender, s.logger)
+	if err != nil {
+		cancel()
+		return id, err
+	}
+	walker, release := cancelable(ctx, client, walker)
+
+	var offset time.Duration
+	if s.jitter > 0 {
+		offset = time.Duration(rand.Int63n(int64(s.jitter)))
+	}
+	j := &job{
+		JobInfo: JobInfo{
+			ID:   id,
+			Host: client.Target,
+			OID:  strings.Join(c.oids(), ","),
+			Freq: c.Freq,
+			Next: time.Now().Add(offset),
+		},
+		count:  c.Count,
+		freq:   c.Freq,
+		client: client,
+		poll:   pollFunc(client, c),
+		walker: walker,
+		avg:    avg,
+		cancel: func() {
+			cancel()
+			release()
+			client.Conn.Close()
+		},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; ok {
+		j.cancel()
+		return id, errors.Errorf("job already scheduled: %s", id)
+	}
+	s.jobs[id] = j
+	heap.Push(&s.queue, j)
+	s.signal()
+	return id, nil
+}
+
+// Remove stops polling of the job with the given id
+func (s *Scheduler) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return errors.Errorf("no such job: %s", id)
+	}
+	s.drop(j)
+	return nil
+}
+
+// drop removes the job from the scheduler, the lock must be held
+func (s *Scheduler) drop(j *job) {
+	delete(s.jobs, j.ID)
+	if j.pos >= 0 {
+		heap.Remove(&s.queue, j.pos)
+	}
+	j.removed = true
+	j.cancel()
+}
+
+// List returns the state of all scheduled jobs, ordered by id
+func (s *Scheduler) List() []JobInfo {
+	s.mu.Lock()
+	list := make([]JobInfo, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j.JobInfo)
+	}
+	s.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Run dispatches jobs to the workers as they become due, until ctx
+// is cancelled, at which point all jobs are removed. Jobs added after
+// that are polled when Run is called again.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	work := make(chan *job)
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				s.run(j)
+			}
+		}()
+	}
+
+	defer func() {
+		close(work)
+		s.mu.Lock()
+		for _, j := range s.jobs {
+			s.drop(j)
+		}
+		// jobs added later must not inherit the cancelled context
+		s.ctx = context.Background()
+		s.mu.Unlock()
+		wg.Wait()
+	}()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		due := make([]*job, 0)
+		now := time.Now()
+		for len(s.queue) > 0 && !s.queue[0].Next.After(now) {
+			due = append(due, heap.Pop(&s.queue).(*job))
+		}
+		wait := time.Hour
+		if len(s.queue) > 0 {
+			wait = s.queue[0].Next.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for _, j := range due {
+			select {
+			case work <- j:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(due) > 0 {
+			// time has passed while dispatching
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// run walks the job and requeues it for its next poll
+func (s *Scheduler) run(j *job) {
+	// stats are in ms but we work in seconds
+	ms, up := j.avg()
+	mean := ms / 1000
+
+	s.mu.Lock()
+	if j.removed {
+		s.mu.Unlock()
+		return
+	}
+	if adj := adjustFreq(j.freq, j.Freq, mean); adj != j.Freq {
+		s.logger.Printf("Adjusting poll for %s/%s from %d to %d seconds (%ds)\n", j.Host, j.OID, j.Freq, adj, mean)
+		j.Freq = adj
+	}
+	j.Last = time.Now()
+	s.mu.Unlock()
+
+	err := j.poll(j.walker, up)
+
+	s.mu.Lock()
+	if j.removed {
+		// the walk was aborted, not failed
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Println(errors.Wrapf(err, "snmp walk failed for %s", j.ID))
+	}
+	// errors represent an event occurred, for stats
+	if s.errFn != nil {
+		s.errFn(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j.removed {
+		return
+	}
+	j.Error = err
+	j.Runs++
+	if j.count > 0 {
+		j.count--
+		if j.count == 0 {
+			s.drop(j)
+			return
+		}
+	}
+	j.Next = j.Last.Add(time.Duration(j.Freq) * time.Second)
+	heap.Push(&s.queue, j)
+	s.signal()
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestScheduler(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var mu sync.Mutex
+	hosts := map[string]int{}
+	polled := make(chan struct{}, 2)
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		mu.Lock()
+		hosts[tags["host"]]++
+		mu.Unlock()
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	errFn := func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	s := NewScheduler(2, 10*time.Millisecond, errFn, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// jobs share the tags map, which must not be modified
+	crit := Criteria{
+		OID:  "system",
+		Tags: testTags,
+		Freq: testFreq,
+	}
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	id, err := s.Add(p, crit, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(p, crit, sender); err == nil {
+		t.Error("expected error adding duplicate job")
+	}
+	if list := s.List(); len(list) != 1 || list[0].ID != id {
+		t.Errorf("unexpected job list: %v", list)
+	}
+	p.Host = "localhost"
+	other, err := s.Add(p, crit, sender)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := testTags["host"]; ok {
+		t.Errorf("criteria tags were modified: %v", testTags)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-polled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no data received from scheduled job")
+		}
+	}
+	for _, id := range []string{id, other} {
+		if err := s.Remove(id); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := s.Remove(id); err == nil {
+		t.Error("expected error removing missing job")
+	}
+	if list := s.List(); len(list) != 0 {
+		t.Errorf("expected no jobs, got: %v", list)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for host, n := range hosts {
+		if host != "127.0.0.1" && host != "localhost" || n == 0 {
+			t.Errorf("unexpected host tags: %v", hosts)
+		}
+	}
+}
+
+func TestSchedulerRestart(t *testing.T) {
+	a := agentsim.New()
+	a.Set(sysName, gosnmp.OctetString, "sw1")
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	polled := make(chan struct{}, 1)
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	errFn := func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	s := NewScheduler(1, 0, errFn, logger)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- s.Run(ctx) }()
+	cancel()
+	<-done
+
+	// a job added after the scheduler stopped is polled when it runs again
+	crit := Criteria{OID: "system", Freq: testFreq}
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	if _, err := s.Add(p, crit, sender); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+	select {
+	case <-polled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no data received from restarted scheduler")
+	}
+}
@@ -7,6 +7,7 @@ package snmputil
 import (
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"strings"
 	"time"
@@ -25,8 +26,22 @@ type Recipe struct {
 type Recipies map[string]Recipe
 
 type dataPoint struct {
-	value uint64
-	when  time.Time
+	value  uint64
+	when   time.Time
+	uptime time.Duration
+}
+
+// counterDelta returns the change in a counter, allowing for a wrap of
+// its width (32 bits unless the value is 64 bits)
+func counterDelta(value interface{}, this, prior uint64) uint64 {
+	if this >= prior {
+		return this - prior
+	}
+	switch value.(type) {
+	case uint64, int64:
+		return this - prior // unsigned arithmetic wraps at 64 bits
+	}
+	return (this + 1<<32 - prior) & math.MaxUint32
 }
 
 // counter datatype
@@ -50,7 +65,9 @@ func counter(value interface{}) (uint64, error) {
 }
 
 // CalcSender returns a sender that optionally "cooks" the data
-// It requires OIDTag to be true in the snmp criteria to track state
+// It requires OIDTag to be true in the snmp criteria to track state.
+// Counter wraps are distinguished from device resets by the agent uptime,
+// and samples spanning a reset are dropped.
 //
 // A example:
 //    r := snmp.Recipies{
@@ -76,14 +93,25 @@ func CalcSender(sender Sender, cook Recipies) Sender {
 				return err
 			}
 
-			if prior, ok := saved[oid]; ok {
+			prior, ok := saved[oid]
+
+			// If the agent uptime has gone backwards the device was
+			// reset and the counters restarted, so the sample is dropped
+			if ok && ts.Uptime > 0 && ts.Uptime < prior.uptime {
+				ok = false
+			}
+
+			if ok {
 				// If the new value is *less* than the prior it was either
 				// a counter wrap or a device reset.
-				// Because device resets happen, we should assume the lesser
-				// value is due to that rather than get a possibly huge spike.
+				// Without the agent uptime to rule out a reset, we should
+				// assume the lesser value is due to that rather than get
+				// a possibly huge spike.
 				delta := this
 				if this >= prior.value {
 					delta -= prior.value
+				} else if ts.Uptime > 0 && prior.uptime > 0 {
+					delta = counterDelta(value, this, prior.value)
 				}
 
 				aka := name
@@ -101,7 +129,7 @@ func CalcSender(sender Sender, cook Recipies) Sender {
 				}
 			}
 
-			saved[oid] = dataPoint{this, ts.Stop}
+			saved[oid] = dataPoint{this, ts.Stop, ts.Uptime}
 			if recipe.Orig {
 				return sender(name, tags, value, ts)
 			}
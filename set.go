@@ -0,0 +1,271 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+// SetErrors are the errors of a Set, keyed by the name of each value
+type SetErrors map[string]error
+
+func (s SetErrors) Error() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	msgs := make([]string, len(names))
+	for i, name := range names {
+		msgs[i] = fmt.Sprintf("%s: %s", name, s[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// instanceOID resolves a name with an optional instance suffix,
+// e.g., "ifAdminStatus.3" or "sysName.0", into its OID
+func instanceOID(name string) (string, error) {
+	if strings.HasPrefix(name, ".") {
+		return name, nil
+	}
+	if oid, err := getOID(name); err == nil {
+		return oid, nil
+	}
+	dot := strings.Index(name, ".")
+	if dot < 0 {
+		return name, errors.Errorf("no OID found for %s", name)
+	}
+	oid, err := getOID(name[:dot])
+	if err != nil {
+		return name, err
+	}
+	return oid + name[dot:], nil
+}
+
+// objectInfo returns the info of the object the OID is an instance of
+func objectInfo(oid string) (oidInfo, bool) {
+	for len(oid) > 0 {
+		if info, ok := oidBase[oid]; ok {
+			return info, true
+		}
+		oid = oid[:strings.LastIndex(oid, ".")]
+	}
+	return oidInfo{}, false
+}
+
+// intValue converts numeric types (and numeric strings) to an integer
+func intValue(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, errors.Errorf("value out of range: %d", v)
+		}
+		return int64(v), nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, errors.Errorf("invalid numeric type:%T value:%v", value, value)
+}
+
+// encodeValue converts the value to the type required by the MIB syntax.
+// Enumerations may be given by label, e.g., "down", and BITS by a list
+// of labels.
+func encodeValue(m MibInfo, value interface{}) (gosnmp.Asn1BER, interface{}, error) {
+	syntax := m.Syntax
+	kind, labels := looker(syntax)
+	switch kind {
+	case "INTEGER":
+		if label, ok := value.(string); ok {
+			for i, name := range labels {
+				if name == label {
+					return gosnmp.Integer, i, nil
+				}
+			}
+			if _, err := strconv.Atoi(label); err != nil {
+				return 0, nil, errors.Errorf("invalid label: %s", label)
+			}
+		}
+		i, err := intValue(value)
+		if err != nil {
+			return 0, nil, err
+		}
+		if _, ok := labels[int(i)]; !ok {
+			return 0, nil, errors.Errorf("invalid enumeration: %d", i)
+		}
+		return gosnmp.Integer, int(i), nil
+	case "BITS":
+		names, ok := value.([]string)
+		if !ok {
+			if s, ok := value.(string); ok {
+				names = strings.Fields(strings.Replace(s, ",", " ", -1))
+			} else {
+				return 0, nil, errors.Errorf("invalid BITS type:%T value:%v", value, value)
+			}
+		}
+		bits := map[string]int{}
+		size := 0
+		for i, name := range labels {
+			bits[name] = i
+			if i/8 >= size {
+				size = i/8 + 1
+			}
+		}
+		b := make([]byte, size)
+		for _, name := range names {
+			i, ok := bits[name]
+			if !ok {
+				return 0, nil, errors.Errorf("invalid bit: %s", name)
+			}
+			b[i/8] |= 0x80 >> uint(i%8)
+		}
+		return gosnmp.OctetString, b, nil
+	}
+
+	switch {
+	case strings.HasPrefix(syntax, "IpAddress"):
+		s, ok := value.(string)
+		if !ok || net.ParseIP(s).To4() == nil {
+			return 0, nil, errors.Errorf("invalid IP address: %v", value)
+		}
+		return gosnmp.IPAddress, s, nil
+	case isOctets(syntax):
+		switch v := value.(type) {
+		case string:
+			return gosnmp.OctetString, []byte(v), nil
+		case []byte:
+			return gosnmp.OctetString, v, nil
+		}
+		return 0, nil, errors.Errorf("invalid string type:%T value:%v", value, value)
+	case strings.HasPrefix(syntax, "OBJECT IDENTIFIER"), syntax == "AutonomousType":
+		s, ok := value.(string)
+		if !ok {
+			return 0, nil, errors.Errorf("invalid OID type:%T value:%v", value, value)
+		}
+		oid, err := instanceOID(s)
+		if err != nil {
+			return 0, nil, err
+		}
+		return gosnmp.ObjectIdentifier, oid, nil
+	}
+
+	i, err := intValue(value)
+	if err != nil {
+		return 0, nil, err
+	}
+	unsigned := func(kind gosnmp.Asn1BER) (gosnmp.Asn1BER, interface{}, error) {
+		if i < 0 || i > math.MaxUint32 {
+			return 0, nil, errors.Errorf("value out of range: %d", i)
+		}
+		return kind, uint32(i), nil
+	}
+	switch {
+	case strings.HasPrefix(syntax, "Gauge32"), strings.HasPrefix(syntax, "Unsigned32"):
+		return unsigned(gosnmp.Gauge32)
+	case strings.HasPrefix(syntax, "TimeTicks"), strings.HasPrefix(syntax, "TimeStamp"):
+		return unsigned(gosnmp.TimeTicks)
+	case strings.HasPrefix(syntax, "INTEGER"), strings.HasPrefix(syntax, "Integer32"):
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return 0, nil, errors.Errorf("value out of range: %d", i)
+		}
+		return gosnmp.Integer, int(i), nil
+	}
+	return 0, nil, errors.Errorf("unsupported syntax: %s", syntax)
+}
+
+// setPDU returns the PDU to set the named value
+func setPDU(name string, value interface{}) (gosnmp.SnmpPDU, error) {
+	oid, err := instanceOID(name)
+	if err != nil {
+		return gosnmp.SnmpPDU{}, err
+	}
+	info, ok := objectInfo(oid)
+	if !ok {
+		return gosnmp.SnmpPDU{}, errors.Errorf("no MIB info found for %s", oid)
+	}
+	switch info.Mib.Access {
+	case "read-only", "not-accessible", "accessible-for-notify":
+		return gosnmp.SnmpPDU{}, errors.Errorf("%s is %s", info.Name, info.Mib.Access)
+	}
+	kind, v, err := encodeValue(info.Mib, value)
+	if err != nil {
+		return gosnmp.SnmpPDU{}, err
+	}
+	return gosnmp.SnmpPDU{Name: oid, Type: kind, Value: v}, nil
+}
+
+// Set sets the values on the device specified using the given Profile.
+// Values are keyed by name (or OID) of the object instance, e.g.,
+// "ifAdminStatus.3", and are encoded per the MIB syntax of the object.
+// All values are set in a single request, so either all are set or none.
+// Errors for specific values are returned as SetErrors.
+func Set(p Profile, values map[string]interface{}) error {
+	if len(values) == 0 {
+		return errors.New("no values to set")
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failed := SetErrors{}
+	pdus := make([]gosnmp.SnmpPDU, 0, len(names))
+	for _, name := range names {
+		pdu, err := setPDU(name, values[name])
+		if err != nil {
+			failed[name] = err
+			continue
+		}
+		pdus = append(pdus, pdu)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+	defer client.Conn.Close()
+
+	resp, err := client.Set(pdus)
+	if err != nil {
+		return err
+	}
+	if resp.Error != gosnmp.NoError {
+		i := int(resp.ErrorIndex) - 1
+		if i < 0 || i >= len(names) {
+			return errors.Errorf("set failed: %v", resp.Error)
+		}
+		return SetErrors{names[i]: errors.Errorf("set failed: %v", resp.Error)}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"testing"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestSet(t *testing.T) {
+	const entry = ".1.3.6.1.3.9998.1.1"
+	for _, m := range []MibInfo{
+		{Name: "SET-MIB::setTable", OID: ".1.3.6.1.3.9998.1", Syntax: "SEQUENCE OF SetEntry"},
+		{Name: "SET-MIB::setEntry", OID: entry, Syntax: "SetEntry", Index: "{ setIndex }"},
+		{Name: "SET-MIB::setIndex", OID: entry + ".1", Syntax: "Integer32", Access: "not-accessible"},
+		{Name: "SET-MIB::setAdmin", OID: entry + ".2", Syntax: "INTEGER { up(1), down(2), testing(3) }", Access: "read-write"},
+		{Name: "SET-MIB::setAlias", OID: entry + ".3", Syntax: "OCTET STRING (SIZE(0..64))", Hint: "255a", Access: "read-write"},
+		{Name: "SET-MIB::setSpeed", OID: entry + ".4", Syntax: "Gauge32", Access: "read-write"},
+		{Name: "SET-MIB::setInOctets", OID: entry + ".5", Syntax: "Counter32", Access: "read-only"},
+	} {
+		oidReader(m)
+	}
+
+	a := agentsim.New()
+	a.Set(entry+".2.1", gosnmp.Integer, 1)
+	a.Set(entry+".3.1", gosnmp.OctetString, "uplink")
+	a.Set(entry+".4.1", gosnmp.Gauge32, 100)
+	a.Set(entry+".5.1", gosnmp.Counter32, 0)
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+
+	err := Set(p, map[string]interface{}{
+		"setAdmin.1": "down",
+		"setAlias.1": "core link",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pdu, _ := a.Get(entry + ".2.1"); pdu.Value != 2 {
+		t.Errorf("expected setAdmin of 2, got: %v", pdu.Value)
+	}
+	if pdu, _ := a.Get(entry + ".3.1"); string(pdu.Value.([]byte)) != "core link" {
+		t.Errorf("expected setAlias of core link, got: %s", pdu.Value)
+	}
+
+	// invalid values are reported per name and nothing is set
+	err = Set(p, map[string]interface{}{
+		"setAdmin.1":    "sideways",
+		"setSpeed.1":    -1,
+		"setInOctets.1": 10,
+		"setAlias.1":    "unchanged",
+	})
+	errs, ok := err.(SetErrors)
+	if !ok {
+		t.Fatalf("expected SetErrors, got: %v", err)
+	}
+	for _, name := range []string{"setAdmin.1", "setSpeed.1", "setInOctets.1"} {
+		if _, ok := errs[name]; !ok {
+			t.Errorf("expected error for %s, got: %v", name, errs)
+		}
+	}
+	if len(errs) != 3 {
+		t.Errorf("expected 3 errors, got: %v", errs)
+	}
+	if pdu, _ := a.Get(entry + ".3.1"); string(pdu.Value.([]byte)) != "core link" {
+		t.Errorf("expected setAlias of core link, got: %s", pdu.Value)
+	}
+
+	// errors from the agent are attributed to the failing value
+	err = Set(p, map[string]interface{}{
+		"setAlias.1": "new",
+		"setAlias.2": "missing",
+	})
+	errs, ok = err.(SetErrors)
+	if !ok || len(errs) != 1 || errs["setAlias.2"] == nil {
+		t.Errorf("expected error for setAlias.2, got: %v", err)
+	}
+}
+
+func TestEncodeValue(t *testing.T) {
+	tests := []struct {
+		syntax string
+		value  interface{}
+		kind   gosnmp.Asn1BER
+		want   interface{}
+	}{
+		{"INTEGER { up(1), down(2) }", "down", gosnmp.Integer, 2},
+		{"INTEGER { up(1), down(2) }", 1, gosnmp.Integer, 1},
+		{"Integer32 (1..10)", "7", gosnmp.Integer, 7},
+		{"Unsigned32", uint(5), gosnmp.Gauge32, uint32(5)},
+		{"TimeTicks", 100, gosnmp.TimeTicks, uint32(100)},
+		{"IpAddress", "10.0.0.1", gosnmp.IPAddress, "10.0.0.1"},
+		{"OBJECT IDENTIFIER", ".1.3.6.1", gosnmp.ObjectIdentifier, ".1.3.6.1"},
+	}
+	for _, test := range tests {
+		kind, v, err := encodeValue(MibInfo{Syntax: test.syntax}, test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.syntax, err)
+			continue
+		}
+		if kind != test.kind || v != test.want {
+			t.Errorf("%s expected %v (%s), got: %v (%s)", test.syntax, test.want, test.kind, v, kind)
+		}
+	}
+
+	kind, v, err := encodeValue(MibInfo{Syntax: "BITS { a(0), b(1), i(8) }"}, []string{"b", "i"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := v.([]byte); kind != gosnmp.OctetString || len(b) != 2 || b[0] != 0x40 || b[1] != 0x80 {
+		t.Errorf("unexpected BITS encoding: %v", v)
+	}
+
+	for _, test := range []struct {
+		syntax string
+		value  interface{}
+	}{
+		{"INTEGER { up(1), down(2) }", 3},
+		{"IpAddress", "not.an.ip"},
+		{"Integer32", 1.5},
+		{"Gauge32", -1},
+	} {
+		if _, _, err := encodeValue(MibInfo{Syntax: test.syntax}, test.value); err == nil {
+			t.Errorf("%s expected error for %v", test.syntax, test.value)
+		}
+	}
+}
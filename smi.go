@@ -0,0 +1,933 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// MibDirs is the search path used by the native MIB parser.
+// It is initialized from $MIBDIRS (colon separated) if set,
+// otherwise the net-snmp default locations are used.
+var MibDirs = mibDirs()
+
+const (
+	tokIdent = iota
+	tokNumber
+	tokString
+	tokPunct
+)
+
+// SMI types that are not reduced any further when rendering syntax
+var smiBase = map[string]bool{
+	"INTEGER":           true,
+	"OCTET STRING":      true,
+	"OBJECT IDENTIFIER": true,
+	"BITS":              true,
+	"Integer32":         true,
+	"Unsigned32":        true,
+	"Counter":           true,
+	"Counter32":         true,
+	"Counter64":         true,
+	"Gauge":             true,
+	"Gauge32":           true,
+	"TimeTicks":         true,
+	"IpAddress":         true,
+	"NetworkAddress":    true,
+	"Opaque":            true,
+}
+
+// well known OIDs, used when the defining module is not available
+var smiRoots = map[string]string{
+	"ccitt":           ".0",
+	"iso":             ".1",
+	"joint-iso-ccitt": ".2",
+	"zeroDotZero":     ".0.0",
+	"org":             ".1.3",
+	"dod":             ".1.3.6",
+	"internet":        ".1.3.6.1",
+	"directory":       ".1.3.6.1.1",
+	"mgmt":            ".1.3.6.1.2",
+	"mib-2":           ".1.3.6.1.2.1",
+	"transmission":    ".1.3.6.1.2.1.10",
+	"experimental":    ".1.3.6.1.3",
+	"private":         ".1.3.6.1.4",
+	"enterprises":     ".1.3.6.1.4.1",
+	"security":        ".1.3.6.1.5",
+	"snmpV2":          ".1.3.6.1.6",
+	"snmpDomains":     ".1.3.6.1.6.1",
+	"snmpProxys":      ".1.3.6.1.6.2",
+	"snmpModules":     ".1.3.6.1.6.3",
+}
+
+// mibDirs returns the default MIB search path
+func mibDirs() []string {
+	if env := os.Getenv("MIBDIRS"); len(env) > 0 {
+		return filepath.SplitList(env)
+	}
+	dirs := []string{}
+	if home := os.Getenv("HOME"); len(home) > 0 {
+		dirs = append(dirs, filepath.Join(home, ".snmp", "mibs"))
+	}
+	return append(dirs, "/usr/share/snmp/mibs", "/usr/local/share/snmp/mibs")
+}
+
+type smiToken struct {
+	kind int
+	text string
+	line int
+}
+
+// smiLexer tokenizes SMI source on demand
+type smiLexer struct {
+	r    *bufio.Reader
+	line int
+	buf  []smiToken
+	err  error
+}
+
+func newSMILexer(r io.Reader) *smiLexer {
+	return &smiLexer{r: bufio.NewReader(r), line: 1}
+}
+
+func (l *smiLexer) read() (rune, bool) {
+	c, _, err := l.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			l.err = err
+		}
+		return 0, false
+	}
+	if c == '\n' {
+		l.line++
+	}
+	return c, true
+}
+
+func (l *smiLexer) unread(c rune) {
+	l.r.UnreadRune()
+	if c == '\n' {
+		l.line--
+	}
+}
+
+func isIdent(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_'
+}
+
+// scan returns the next token, or false when the input is exhausted
+func (l *smiLexer) scan() (smiToken, bool) {
+	for {
+		c, ok := l.read()
+		if !ok {
+			return smiToken{}, false
+		}
+		if unicode.IsSpace(c) {
+			continue
+		}
+		line := l.line
+		switch {
+		case c == '-':
+			n, ok := l.read()
+			if ok && n == '-' {
+				l.comment()
+				continue
+			}
+			if ok && unicode.IsDigit(n) {
+				l.unread(n)
+				return smiToken{tokNumber, "-" + l.word(isDigit), line}, true
+			}
+			if ok {
+				l.unread(n)
+			}
+			return smiToken{tokPunct, "-", line}, true
+		case c == '"':
+			return smiToken{tokString, l.quoted(), line}, true
+		case c == '\'':
+			// binary or hex string, e.g., '00'H
+			s := l.until('\'')
+			if n, ok := l.read(); ok {
+				s = "'" + s + "'" + string(n)
+			}
+			return smiToken{tokNumber, s, line}, true
+		case unicode.IsDigit(c):
+			l.unread(c)
+			return smiToken{tokNumber, l.word(isDigit), line}, true
+		case unicode.IsLetter(c):
+			l.unread(c)
+			return smiToken{tokIdent, l.ident(), line}, true
+		case c == ':':
+			if l.match(":=") {
+				return smiToken{tokPunct, "::=", line}, true
+			}
+		case c == '.':
+			if l.match(".") {
+				return smiToken{tokPunct, "..", line}, true
+			}
+		}
+		return smiToken{tokPunct, string(c), line}, true
+	}
+}
+
+func isDigit(c rune) bool {
+	return unicode.IsDigit(c)
+}
+
+// match consumes s if it is next in the input
+func (l *smiLexer) match(s string) bool {
+	b, err := l.r.Peek(len(s))
+	if err != nil || string(b) != s {
+		return false
+	}
+	l.r.Discard(len(s))
+	return true
+}
+
+// comment skips to the end of the line or a closing "--"
+func (l *smiLexer) comment() {
+	for {
+		c, ok := l.read()
+		if !ok || c == '\n' {
+			return
+		}
+		if c == '-' && l.match("-") {
+			return
+		}
+	}
+}
+
+func (l *smiLexer) word(fn func(rune) bool) string {
+	acc := make([]rune, 0, 16)
+	for {
+		c, ok := l.read()
+		if !ok {
+			break
+		}
+		if !fn(c) {
+			l.unread(c)
+			break
+		}
+		acc = append(acc, c)
+	}
+	return string(acc)
+}
+
+// ident reads an identifier, which may contain hyphens but not comments
+func (l *smiLexer) ident() string {
+	acc := make([]rune, 0, 32)
+	for {
+		c, ok := l.read()
+		if !ok {
+			break
+		}
+		if c == '-' {
+			if b, err := l.r.Peek(1); err == nil && b[0] == '-' {
+				l.unread(c)
+				break
+			}
+		}
+		if !isIdent(c) {
+			l.unread(c)
+			break
+		}
+		acc = append(acc, c)
+	}
+	return strings.TrimRight(string(acc), "-")
+}
+
+func (l *smiLexer) until(end rune) string {
+	acc := make([]rune, 0, 64)
+	for {
+		c, ok := l.read()
+		if !ok || c == end {
+			return string(acc)
+		}
+		acc = append(acc, c)
+	}
+}
+
+// quoted reads a string, where "" is an escaped quote
+func (l *smiLexer) quoted() string {
+	s := l.until('"')
+	for l.match(`"`) {
+		s += `"` + l.until('"')
+	}
+	return s
+}
+
+// peek returns the token n positions ahead without consuming it
+func (l *smiLexer) peek(n int) smiToken {
+	for len(l.buf) <= n {
+		t, ok := l.scan()
+		if !ok {
+			return smiToken{kind: tokPunct, line: l.line}
+		}
+		l.buf = append(l.buf, t)
+	}
+	return l.buf[n]
+}
+
+func (l *smiLexer) next() smiToken {
+	t := l.peek(0)
+	if len(l.buf) > 0 {
+		l.buf = l.buf[1:]
+	}
+	return t
+}
+
+func (l *smiLexer) eof() bool {
+	return l.peek(0).text == "" && l.peek(0).kind == tokPunct
+}
+
+func (l *smiLexer) expect(s string) error {
+	if t := l.next(); t.text != s {
+		return errors.Errorf("line %d: expected %q but found %q", t.line, s, t.text)
+	}
+	return nil
+}
+
+// balanced returns the tokens up to and including the matching close
+// of the opening token that is next in the stream
+func (l *smiLexer) balanced() []string {
+	open := l.next().text
+	close := map[string]string{"{": "}", "(": ")", "[": "]"}[open]
+	toks := []string{open}
+	depth := 1
+	for depth > 0 && !l.eof() {
+		t := l.next()
+		switch t.text {
+		case open:
+			depth++
+		case close:
+			depth--
+		}
+		if t.kind == tokString {
+			toks = append(toks, strconv.Quote(t.text))
+			continue
+		}
+		toks = append(toks, t.text)
+	}
+	return toks
+}
+
+// joinTokens renders tokens as compact source text
+func joinTokens(toks []string) string {
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 {
+			prev := toks[i-1]
+			switch {
+			case prev == "(" || t == ")" || t == "(" || t == "," || t == "..":
+			case prev == "..":
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(t)
+	}
+	return b.String()
+}
+
+// listTokens renders a braced list such as INDEX { a, b }
+func listTokens(toks []string) string {
+	items := []string{}
+	item := []string{}
+	for _, t := range toks[1 : len(toks)-1] {
+		if t == "," {
+			items = append(items, strings.Join(item, " "))
+			item = item[:0]
+			continue
+		}
+		item = append(item, t)
+	}
+	if len(item) > 0 {
+		items = append(items, strings.Join(item, " "))
+	}
+	return "{ " + strings.Join(items, ", ") + " }"
+}
+
+// smiType is a parsed type definition
+type smiType struct {
+	base  string // underlying type name
+	enums string // named numbers, e.g., {up(1), down(2)}
+	sub   string // subtype constraints, e.g., (SIZE(0..255))
+	hint  string // DISPLAY-HINT
+	seq   bool   // SEQUENCE or CHOICE
+}
+
+type smiSubID struct {
+	name string
+	num  string
+}
+
+// smiNode is a named object in the OID tree
+type smiNode struct {
+	info   MibInfo
+	macro  string
+	syntax *smiType
+	value  []smiSubID
+	trap   string // TRAP-TYPE number
+	enter  string // TRAP-TYPE enterprise
+	oid    string
+	busy   bool
+}
+
+// smiModule is a parsed MIB module
+type smiModule struct {
+	name    string
+	imports map[string]string
+	types   map[string]*smiType
+	nodes   []*smiNode
+	byName  map[string]*smiNode
+}
+
+// parseSMI parses all of the MIB modules in r
+func parseSMI(r io.Reader) ([]*smiModule, error) {
+	l := newSMILexer(r)
+	mods := []*smiModule{}
+	for !l.eof() {
+		m, err := parseModule(l)
+		if err != nil {
+			if m != nil {
+				err = errors.Wrapf(err, "module %s", m.name)
+			}
+			return mods, err
+		}
+		mods = append(mods, m)
+	}
+	return mods, l.err
+}
+
+// parseModule parses from "NAME DEFINITIONS ::= BEGIN" through "END"
+func parseModule(l *smiLexer) (*smiModule, error) {
+	t := l.next()
+	if t.kind != tokIdent {
+		return nil, errors.Errorf("line %d: expected module name but found %q", t.line, t.text)
+	}
+	m := &smiModule{
+		name:    t.text,
+		imports: make(map[string]string),
+		types:   make(map[string]*smiType),
+		byName:  make(map[string]*smiNode),
+	}
+	if err := l.expect("DEFINITIONS"); err != nil {
+		return m, err
+	}
+	for !l.eof() && l.peek(0).text != "::=" {
+		l.next()
+	}
+	if err := l.expect("::="); err != nil {
+		return m, err
+	}
+	if err := l.expect("BEGIN"); err != nil {
+		return m, err
+	}
+
+	for {
+		t := l.next()
+		switch {
+		case l.err != nil:
+			return m, l.err
+		case t.text == "" && t.kind == tokPunct:
+			return m, errors.Errorf("line %d: unexpected end of module", t.line)
+		case t.text == "END":
+			return m, nil
+		case t.text == "IMPORTS":
+			symbols := []string{}
+			for !l.eof() {
+				t = l.next()
+				if t.text == ";" {
+					break
+				}
+				if t.text == "FROM" {
+					from := l.next().text
+					for _, s := range symbols {
+						m.imports[s] = from
+					}
+					symbols = symbols[:0]
+					continue
+				}
+				if t.kind == tokIdent {
+					symbols = append(symbols, t.text)
+				}
+			}
+		case t.text == "EXPORTS":
+			for !l.eof() && l.next().text != ";" {
+			}
+		case t.kind != tokIdent:
+			return m, errors.Errorf("line %d: unexpected %q", t.line, t.text)
+		case l.peek(0).text == "MACRO":
+			for !l.eof() && l.next().text != "END" {
+			}
+		case unicode.IsUpper(rune(t.text[0])) && l.peek(0).text == "::=":
+			l.next()
+			var typ *smiType
+			if l.peek(0).text == "TEXTUAL-CONVENTION" {
+				l.next()
+				n := &smiNode{}
+				parseClauses(l, n, true)
+				typ = n.syntax
+				if typ == nil {
+					return m, errors.Errorf("line %d: no SYNTAX for %s", t.line, t.text)
+				}
+				typ.hint = n.info.Hint
+			} else {
+				typ = parseType(l)
+			}
+			m.types[t.text] = typ
+		default:
+			n, err := parseValue(l, t.text)
+			if err != nil {
+				return m, err
+			}
+			if n != nil {
+				n.info.Name = m.name + "::" + n.info.Name
+				m.nodes = append(m.nodes, n)
+				m.byName[t.text] = n
+			}
+		}
+	}
+}
+
+// parseValue parses a value assignment, returning a node if it is an OID
+func parseValue(l *smiLexer, name string) (*smiNode, error) {
+	n := &smiNode{info: MibInfo{Name: name}}
+	t := l.next()
+	if t.text == "OBJECT" && l.peek(0).text == "IDENTIFIER" {
+		l.next()
+		n.macro = "OBJECT IDENTIFIER"
+	} else {
+		n.macro = t.text
+		parseClauses(l, n, false)
+	}
+	if err := l.expect("::="); err != nil {
+		return nil, err
+	}
+	switch t := l.peek(0); {
+	case t.text == "{":
+		// components are numbers, names, or both, e.g., { iso(1) org(3) 6 }
+		toks := l.balanced()
+		toks = toks[1 : len(toks)-1]
+		for i := 0; i < len(toks); i++ {
+			sub := smiSubID{}
+			if _, err := strconv.Atoi(toks[i]); err == nil {
+				sub.num = toks[i]
+			} else {
+				sub.name = toks[i]
+				if i+3 < len(toks) && toks[i+1] == "(" {
+					sub.num = toks[i+2]
+					i += 3
+				}
+			}
+			n.value = append(n.value, sub)
+		}
+		return n, nil
+	case n.macro == "TRAP-TYPE" && t.kind == tokNumber:
+		n.trap = l.next().text
+		n.value = []smiSubID{{name: n.enter}}
+		return n, nil
+	case t.text == "(" || t.text == "[":
+		l.balanced()
+	default:
+		l.next()
+	}
+	return nil, nil
+}
+
+// parseClauses reads the clauses of a macro invocation, stopping at "::="
+// or, for a TEXTUAL-CONVENTION, after the SYNTAX clause
+func parseClauses(l *smiLexer, n *smiNode, tc bool) {
+	str := func(s *string) {
+		if l.peek(0).kind == tokString {
+			if v := l.next().text; len(*s) == 0 {
+				*s = v
+			}
+		}
+	}
+	ident := func(s *string) {
+		if l.peek(0).kind == tokIdent {
+			if v := l.next().text; len(*s) == 0 {
+				*s = v
+			}
+		}
+	}
+	list := func(s *string) {
+		if l.peek(0).text == "{" {
+			if v := listTokens(l.balanced()); len(*s) == 0 {
+				*s = v
+			}
+		}
+	}
+	for !l.eof() && l.peek(0).text != "::=" {
+		if t := l.peek(0).text; t == "{" || t == "(" {
+			l.balanced()
+			continue
+		}
+		switch t := l.next(); t.text {
+		case "SYNTAX":
+			typ := parseType(l)
+			if n.syntax == nil {
+				n.syntax = typ
+			}
+			if tc {
+				return
+			}
+		case "DISPLAY-HINT":
+			str(&n.info.Hint)
+		case "UNITS":
+			str(&n.info.Units)
+		case "DESCRIPTION":
+			str(&n.info.Description)
+		case "MAX-ACCESS", "ACCESS":
+			ident(&n.info.Access)
+		case "STATUS":
+			ident(&n.info.Status)
+		case "INDEX":
+			list(&n.info.Index)
+		case "AUGMENTS":
+			list(&n.info.Augments)
+		case "DEFVAL":
+			list(&n.info.Default)
+		case "ENTERPRISE":
+			ident(&n.enter)
+		}
+	}
+}
+
+// parseType parses a type reference or definition
+func parseType(l *smiLexer) *smiType {
+	typ := &smiType{}
+	if l.peek(0).text == "[" {
+		l.balanced()
+	}
+	if t := l.peek(0).text; t == "IMPLICIT" || t == "EXPLICIT" {
+		l.next()
+	}
+	switch t := l.next(); t.text {
+	case "OCTET", "OBJECT":
+		typ.base = t.text + " " + l.next().text
+	case "SEQUENCE":
+		if l.peek(0).text == "OF" {
+			l.next()
+			typ.base = "SEQUENCE OF " + l.next().text
+			return typ
+		}
+		typ.base, typ.seq = t.text, true
+		if l.peek(0).text == "{" {
+			l.balanced()
+		}
+		return typ
+	case "CHOICE":
+		typ.base, typ.seq = t.text, true
+		if l.peek(0).text == "{" {
+			l.balanced()
+		}
+		return typ
+	default:
+		typ.base = t.text
+	}
+	if l.peek(0).text == "{" {
+		toks := l.balanced()
+		typ.enums = "{" + joinTokens(toks[1:len(toks)-1]) + "}"
+	}
+	if l.peek(0).text == "(" {
+		typ.sub = joinTokens(l.balanced())
+	}
+	return typ
+}
+
+// smiSet is a collection of modules loaded from a search path
+type smiSet struct {
+	dirs    []string
+	files   map[string]string
+	modules map[string]*smiModule
+	order   []*smiModule
+}
+
+func newSMISet(dirs []string) *smiSet {
+	return &smiSet{
+		dirs:    dirs,
+		modules: make(map[string]*smiModule),
+	}
+}
+
+// add includes parsed modules in the set
+func (s *smiSet) add(mods ...*smiModule) {
+	for _, m := range mods {
+		if _, ok := s.modules[m.name]; !ok {
+			s.modules[m.name] = m
+			s.order = append(s.order, m)
+		}
+	}
+}
+
+// moduleName returns the name of the first module defined in the file
+func moduleName(filename string) string {
+	f, err := os.Open(filename)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	l := newSMILexer(f)
+	if t := l.next(); t.kind == tokIdent && l.peek(0).text == "DEFINITIONS" {
+		return t.text
+	}
+	return ""
+}
+
+// index maps module names to the files that define them
+func (s *smiSet) index() map[string]string {
+	if s.files != nil {
+		return s.files
+	}
+	s.files = make(map[string]string)
+	for _, dir := range s.dirs {
+		list, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range list {
+			if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			filename := filepath.Join(dir, fi.Name())
+			if name := moduleName(filename); len(name) > 0 {
+				if _, ok := s.files[name]; !ok {
+					s.files[name] = filename
+				}
+			}
+		}
+	}
+	return s.files
+}
+
+// parseFile parses and adds all modules in the file
+func (s *smiSet) parseFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	mods, err := parseSMI(f)
+	s.add(mods...)
+	return errors.Wrap(err, filename)
+}
+
+// load parses the named module and any modules it imports
+func (s *smiSet) load(name string) error {
+	if _, ok := s.modules[name]; ok {
+		return nil
+	}
+	filename, ok := s.index()[name]
+	if !ok {
+		return errors.Errorf("cannot find module %s in %s", name, strings.Join(s.dirs, ":"))
+	}
+	if err := s.parseFile(filename); err != nil {
+		return err
+	}
+	m, ok := s.modules[name]
+	if !ok {
+		return errors.Errorf("module %s not found in %s", name, filename)
+	}
+	return s.imports(m)
+}
+
+// imports loads the modules imported by m. Missing modules are
+// tolerated as the well known SMI definitions are built in.
+func (s *smiSet) imports(m *smiModule) error {
+	seen := make(map[string]bool)
+	for _, from := range m.imports {
+		if seen[from] {
+			continue
+		}
+		seen[from] = true
+		if err := s.load(from); err != nil {
+			if _, ok := s.index()[from]; ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadAll parses every module found in the search path
+func (s *smiSet) loadAll() error {
+	files := s.index()
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := s.modules[name]; !ok {
+			// skip modules that can't be parsed, as net-snmp does
+			s.parseFile(files[name])
+		}
+	}
+	if len(s.modules) == 0 {
+		return errors.Errorf("no MIB modules found in %s", strings.Join(s.dirs, ":"))
+	}
+	return nil
+}
+
+// lookup finds the node or type named in the scope of module m
+func (s *smiSet) lookup(m *smiModule, name string, depth int) (*smiModule, *smiNode, *smiType) {
+	if m == nil || depth > 16 {
+		return nil, nil, nil
+	}
+	if n, ok := m.byName[name]; ok {
+		return m, n, nil
+	}
+	if t, ok := m.types[name]; ok {
+		return m, nil, t
+	}
+	if from, ok := m.imports[name]; ok {
+		return s.lookup(s.modules[from], name, depth+1)
+	}
+	return nil, nil, nil
+}
+
+// resolve returns the dotted OID of name in the scope of module m
+func (s *smiSet) resolve(m *smiModule, name string) (string, bool) {
+	if mod, n, _ := s.lookup(m, name, 0); n != nil {
+		return s.nodeOID(mod, n)
+	}
+	oid, ok := smiRoots[name]
+	return oid, ok
+}
+
+// nodeOID returns the dotted OID of the node
+func (s *smiSet) nodeOID(m *smiModule, n *smiNode) (string, bool) {
+	if len(n.oid) > 0 || n.busy || len(n.value) == 0 {
+		return n.oid, len(n.oid) > 0
+	}
+	n.busy = true
+	defer func() { n.busy = false }()
+
+	first := n.value[0]
+	oid := "." + first.num
+	if len(first.num) == 0 {
+		var ok bool
+		if oid, ok = s.resolve(m, first.name); !ok {
+			return "", false
+		}
+	}
+	for _, sub := range n.value[1:] {
+		if len(sub.num) == 0 {
+			return "", false
+		}
+		oid += "." + sub.num
+	}
+	if len(n.trap) > 0 {
+		oid += ".0." + n.trap
+	}
+	n.oid = oid
+	return oid, true
+}
+
+// syntax renders the syntax and display hint of a type, following
+// textual conventions down to their base type
+func (s *smiSet) syntax(m *smiModule, t *smiType) (string, string) {
+	var enums, sub, hint string
+	base := t.base
+	for depth := 0; depth < 16; depth++ {
+		if len(hint) == 0 {
+			hint = t.hint
+		}
+		if len(enums) == 0 {
+			enums = t.enums
+		}
+		if len(sub) == 0 {
+			sub = t.sub
+		}
+		base = t.base
+		if smiBase[base] || t.seq {
+			break
+		}
+		mod, _, next := s.lookup(m, base, 0)
+		if next == nil || next.seq {
+			break
+		}
+		m, t = mod, next
+	}
+	switch {
+	case len(enums) > 0:
+		return base + " " + enums, hint
+	case len(sub) > 0:
+		return base + " " + sub, hint
+	}
+	return base, hint
+}
+
+// walk applies fn to every resolvable object in the set
+func (s *smiSet) walk(fn mibFunc) {
+	for _, m := range s.order {
+		for _, n := range m.nodes {
+			oid, ok := s.nodeOID(m, n)
+			if !ok {
+				continue
+			}
+			info := n.info
+			info.OID = oid
+			if n.syntax != nil && n.macro == "OBJECT-TYPE" {
+				info.Syntax, info.Hint = s.syntax(m, n.syntax)
+			}
+			lines := strings.Split(info.Description, "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			info.Description = strings.Join(lines, "\n")
+			fn(info)
+		}
+	}
+}
+
+// loadSMI returns the set of modules named in mibs (colon separated)
+func loadSMI(mibs string) (*smiSet, error) {
+	s := newSMISet(MibDirs)
+	if len(mibs) == 0 || mibs == "ALL" {
+		return s, s.loadAll()
+	}
+	for _, name := range strings.Split(mibs, ":") {
+		if err := s.load(name); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// ParseMIBs reads the MIBs specified (colon separated, or ALL) from
+// the MibDirs search path and applies fn to the details of each OID
+func ParseMIBs(mibs string, fn func(MibInfo)) error {
+	s, err := loadSMI(mibs)
+	if err != nil {
+		return err
+	}
+	s.walk(fn)
+	return nil
+}
+
+// smiNames returns the OIDs and their names from the mib(s) specified
+func smiNames(mibs string) (map[string]string, error) {
+	m := make(map[string]string)
+	err := ParseMIBs(mibs, func(info MibInfo) {
+		name := info.Name
+		if i := strings.Index(name, "::"); i > 0 {
+			name = name[i+2:]
+		}
+		m[name] = info.OID
+	})
+	return m, err
+}
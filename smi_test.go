@@ -0,0 +1,228 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTC = `
+TEST-TC DEFINITIONS ::= BEGIN
+
+IMPORTS
+    TimeTicks FROM SNMPv2-SMI;   -- a comment
+
+-- the textual conventions
+DisplayString ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "255a"
+    STATUS       current
+    DESCRIPTION
+            "Represents textual information, with ""quotes""."
+    SYNTAX       OCTET STRING (SIZE (0..255))
+
+PhysAddress ::= TEXTUAL-CONVENTION
+    DISPLAY-HINT "1x:"
+    STATUS       current
+    DESCRIPTION  "Represents media- or physical-level addresses."
+    SYNTAX       OCTET STRING
+
+TruthValue ::= TEXTUAL-CONVENTION
+    STATUS       current
+    DESCRIPTION  "Represents a boolean value."
+    SYNTAX       INTEGER { true(1), false(2) }
+
+Alias ::= DisplayString
+
+END
+`
+
+const testMIB = `
+TEST-MIB DEFINITIONS ::= BEGIN
+
+IMPORTS
+    MODULE-IDENTITY, OBJECT-TYPE, Counter32, Integer32, mib-2
+        FROM SNMPv2-SMI
+    DisplayString, PhysAddress, TruthValue, Alias
+        FROM TEST-TC;
+
+testMIB MODULE-IDENTITY
+    LAST-UPDATED "201601010000Z"
+    ORGANIZATION "none"
+    CONTACT-INFO "none"
+    DESCRIPTION  "A test module."
+    REVISION     "201601010000Z"
+    DESCRIPTION  "Initial revision."
+    ::= { mib-2 9999 }
+
+testTable OBJECT-TYPE
+    SYNTAX      SEQUENCE OF TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A table."
+    ::= { testMIB 1 }
+
+testEntry OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "A row."
+    INDEX       { testIndex, IMPLIED testName }
+    ::= { testTable 1 }
+
+TestEntry ::= SEQUENCE {
+    testIndex   Integer32,
+    testName    DisplayString,
+    testStatus  INTEGER,
+    testOctets  Counter32
+}
+
+testIndex OBJECT-TYPE
+    SYNTAX      Integer32 (1..2147483647)
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The index."
+    ::= { testEntry 1 }
+
+testName OBJECT-TYPE
+    SYNTAX      Alias
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION
+            "The name,
+            spread across lines."
+    ::= { testEntry 2 }
+
+testStatus OBJECT-TYPE
+    SYNTAX      INTEGER { up(1), down(2), testing(3) }
+    MAX-ACCESS  read-write
+    STATUS      current
+    DESCRIPTION "The status."
+    DEFVAL      { up }
+    ::= { testEntry 3 }
+
+testOctets OBJECT-TYPE
+    SYNTAX      Counter32
+    UNITS       "octets"
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The octets."
+    ::= { testEntry 4 }
+
+testMac OBJECT-TYPE
+    SYNTAX      PhysAddress
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "The address."
+    ::= { testEntry 5 }
+
+testEnabled OBJECT-TYPE
+    SYNTAX      TruthValue
+    MAX-ACCESS  read-only
+    STATUS      current
+    DESCRIPTION "Enabled."
+    ::= { testEntry 6 }
+
+testAugment OBJECT-TYPE
+    SYNTAX      TestEntry
+    MAX-ACCESS  not-accessible
+    STATUS      current
+    DESCRIPTION "An augmented row."
+    AUGMENTS    { testEntry }
+    ::= { testMIB 2 }
+
+testRoot OBJECT IDENTIFIER ::= { iso(1) org(3) dod(6) 99 }
+
+END
+`
+
+func TestParseSMI(t *testing.T) {
+	s := newSMISet(nil)
+	for _, text := range []string{testTC, testMIB} {
+		mods, err := parseSMI(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.add(mods...)
+	}
+	got := make(map[string]MibInfo)
+	s.walk(func(m MibInfo) {
+		got[m.Name] = m
+	})
+
+	check := func(name, field, have, want string) {
+		if have != want {
+			t.Errorf("%s %s: expected %q but got %q", name, field, want, have)
+		}
+	}
+	for name, want := range map[string]MibInfo{
+		"TEST-MIB::testMIB":     {OID: ".1.3.6.1.2.1.9999", Description: "A test module."},
+		"TEST-MIB::testTable":   {OID: ".1.3.6.1.2.1.9999.1", Syntax: "SEQUENCE OF TestEntry"},
+		"TEST-MIB::testEntry":   {OID: ".1.3.6.1.2.1.9999.1.1", Syntax: "TestEntry", Index: "{ testIndex, IMPLIED testName }"},
+		"TEST-MIB::testIndex":   {OID: ".1.3.6.1.2.1.9999.1.1.1", Syntax: "Integer32 (1..2147483647)", Access: "read-only"},
+		"TEST-MIB::testName":    {OID: ".1.3.6.1.2.1.9999.1.1.2", Syntax: "OCTET STRING (SIZE(0..255))", Hint: "255a", Description: "The name,\nspread across lines."},
+		"TEST-MIB::testStatus":  {OID: ".1.3.6.1.2.1.9999.1.1.3", Syntax: "INTEGER {up(1), down(2), testing(3)}", Default: "{ up }"},
+		"TEST-MIB::testOctets":  {OID: ".1.3.6.1.2.1.9999.1.1.4", Syntax: "Counter32", Units: "octets"},
+		"TEST-MIB::testMac":     {OID: ".1.3.6.1.2.1.9999.1.1.5", Syntax: "OCTET STRING", Hint: "1x:"},
+		"TEST-MIB::testEnabled": {OID: ".1.3.6.1.2.1.9999.1.1.6", Syntax: "INTEGER {true(1), false(2)}"},
+		"TEST-MIB::testAugment": {OID: ".1.3.6.1.2.1.9999.2", Augments: "{ testEntry }"},
+		"TEST-MIB::testRoot":    {OID: ".1.3.6.99"},
+	} {
+		have, ok := got[name]
+		if !ok {
+			t.Errorf("%s not found", name)
+			continue
+		}
+		check(name, "OID", have.OID, want.OID)
+		if len(want.Syntax) > 0 {
+			check(name, "Syntax", have.Syntax, want.Syntax)
+		}
+		check(name, "Hint", have.Hint, want.Hint)
+		check(name, "Index", have.Index, want.Index)
+		check(name, "Augments", have.Augments, want.Augments)
+		check(name, "Units", have.Units, want.Units)
+		check(name, "Default", have.Default, want.Default)
+		if len(want.Access) > 0 {
+			check(name, "Access", have.Access, want.Access)
+		}
+		if len(want.Description) > 0 {
+			check(name, "Description", have.Description, want.Description)
+		}
+	}
+}
+
+func TestParseMIBs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mibs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// file names need not match module names
+	if err := ioutil.WriteFile(filepath.Join(dir, "tc.txt"), []byte(testTC), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "test.mib"), []byte(testMIB), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := MibDirs
+	MibDirs = []string{dir}
+	defer func() { MibDirs = saved }()
+
+	names, err := oidNames("TEST-MIB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oid := names["testOctets"]; oid != ".1.3.6.1.2.1.9999.1.1.4" {
+		t.Errorf("unexpected OID for testOctets: %q", oid)
+	}
+	if _, err := oidNames("NO-SUCH-MIB"); err == nil {
+		t.Error("expected error for missing MIB")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+// Row is a conceptual row of a MIB table
+type Row struct {
+	Index   map[string]interface{} // decoded index values by name
+	Columns map[string]interface{} // column values by name
+}
+
+// Table contains the rows of a MIB table, keyed by their decoded index.
+// Index values are joined with "." to form the key, e.g., "1" or "10.0.0.1"
+type Table struct {
+	Name    string          // name of the table
+	Index   []string        // names of the index objects
+	Columns []string        // names of the columns, in OID order
+	Rows    map[string]*Row // rows by decoded index
+	keys    []string
+}
+
+// Keys returns the row keys in the order returned by the agent
+func (t *Table) Keys() []string {
+	keys := make([]string, len(t.keys))
+	copy(keys, t.keys)
+	return keys
+}
+
+// tableColumns returns the columns of the table entry in OID order
+func tableColumns(entry string) []oidInfo {
+	cols := []oidInfo{}
+	prefix := entry + "."
+	for oid, info := range oidBase {
+		if strings.HasPrefix(oid, prefix) && !strings.Contains(oid[len(prefix):], ".") {
+			cols = append(cols, info)
+		}
+	}
+	sort.Sort(byOID(cols))
+	return cols
+}
+
+type byOID []oidInfo
+
+func (b byOID) Len() int           { return len(b) }
+func (b byOID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byOID) Less(i, j int) bool { return oidLess(b[i].Mib.OID, b[j].Mib.OID) }
+
+// oidLess returns true if dotted OID a sorts before b
+func oidLess(a, b string) bool {
+	x, y := Octets(strings.TrimPrefix(a, ".")), Octets(strings.TrimPrefix(b, "."))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			return x[i] < y[i]
+		}
+	}
+	return len(x) < len(y)
+}
+
+// tableEntry returns the entry of the table (or the entry itself)
+func tableEntry(tableOID string) (oidInfo, error) {
+	oid, err := getOID(tableOID)
+	if err != nil {
+		return oidInfo{}, err
+	}
+	info, ok := oidBase[oid]
+	if !ok {
+		return info, errors.Errorf("no MIB info found for table: %s", tableOID)
+	}
+	if strings.HasPrefix(info.Mib.Syntax, "SEQUENCE OF") {
+		if info, ok = oidBase[oid+".1"]; !ok {
+			return info, errors.Errorf("no entry found for table: %s", tableOID)
+		}
+	}
+	if len(info.Mib.Index) == 0 && len(info.Mib.Augments) == 0 {
+		return info, errors.Errorf("%s is not a table", tableOID)
+	}
+	return info, nil
+}
+
+// WalkTable walks the table (or table entry) specified by name or OID
+// and returns its rows. Columns of any tables that augment it are
+// included in the same rows.
+func WalkTable(p Profile, tableOID string) (*Table, error) {
+	entry, err := tableEntry(tableOID)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := entryIndex(entry.Mib)
+	if err != nil {
+		return nil, err
+	}
+
+	// augmenting entries share the same rows
+	entries := []oidInfo{entry}
+	for _, info := range oidBase {
+		if strings.Trim(info.Mib.Augments, "{} ") == entry.String() {
+			entries = append(entries, info)
+		}
+	}
+
+	t := &Table{
+		Name: strings.TrimPrefix(entry.Mib.OID, "."),
+		Rows: make(map[string]*Row),
+	}
+	if table, ok := oidBase[entry.Mib.OID[:strings.LastIndex(entry.Mib.OID, ".")]]; ok {
+		t.Name = table.String()
+	}
+	for _, part := range parts {
+		t.Index = append(t.Index, part.Name)
+	}
+
+	columns := make(map[string]oidInfo)
+	for _, e := range entries {
+		for _, col := range tableColumns(e.Mib.OID) {
+			if col.Mib.Access == "not-accessible" {
+				continue
+			}
+			columns[col.Mib.OID] = col
+			t.Columns = append(t.Columns, col.String())
+		}
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Conn.Close()
+
+	for _, e := range entries {
+		prefix := e.Mib.OID + "."
+		walker := func(pdu gosnmp.SnmpPDU) error {
+			if !strings.HasPrefix(pdu.Name, prefix) {
+				return nil
+			}
+			rest := pdu.Name[len(prefix):]
+			dot := strings.Index(rest, ".")
+			if dot < 0 {
+				return nil
+			}
+			colOID, suffix := prefix+rest[:dot], rest[dot+1:]
+
+			name := colOID
+			value := pdu.Value
+			if col, ok := columns[colOID]; ok {
+				name = col.String()
+				if v, err := col.Fn(pdu); err == nil {
+					value = v
+				}
+			}
+
+			// fall back to the raw suffix if the index cannot be decoded
+			key := suffix
+			values, err := decodeIndex(parts, suffix)
+			if err == nil {
+				key = indexKey(values)
+			}
+			row, ok := t.Rows[key]
+			if !ok {
+				row = &Row{Columns: make(map[string]interface{})}
+				if err == nil {
+					row.Index = make(map[string]interface{}, len(parts))
+					for i, part := range parts {
+						row.Index[part.Name] = values[i]
+					}
+				}
+				t.Rows[key] = row
+				t.keys = append(t.keys, key)
+			}
+			row.Columns[name] = value
+			return nil
+		}
+		if err := bulkWalker(client, e.Mib.OID, walker); err != nil {
+			return nil, errors.Wrapf(err, "walking %s", e.String())
+		}
+	}
+	return t, nil
+}
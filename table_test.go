@@ -0,0 +1,99 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/paulstuart/snmputil/agentsim"
+	"github.com/soniah/gosnmp"
+)
+
+func TestDecodeIndex(t *testing.T) {
+	parts := []indexPart{
+		{Name: "ifIndex", Mib: MibInfo{Syntax: "Integer32 (1..2147483647)"}},
+		{Name: "addr", Mib: MibInfo{Syntax: "IpAddress"}},
+		{Name: "mac", Mib: MibInfo{Syntax: "OCTET STRING (SIZE(6))"}},
+		{Name: "oid", Mib: MibInfo{Syntax: "OBJECT IDENTIFIER"}},
+		{Name: "name", Implied: true, Mib: MibInfo{Syntax: "OCTET STRING (SIZE(0..32))"}},
+	}
+	values, err := decodeIndex(parts, "3.10.0.0.1.0.17.34.51.68.85.2.1.3.101.116.104.48")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{3, "10.0.0.1", "00:11:22:33:44:55", ".1.3", "eth0"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("expected: %v got: %v", want, values)
+	}
+	if key := indexKey(values); key != "3.10.0.0.1.00:11:22:33:44:55..1.3.eth0" {
+		t.Errorf("unexpected key: %s", key)
+	}
+
+	// strings are length prefixed unless implied, enums are labelled
+	parts = []indexPart{
+		{Name: "name", Mib: MibInfo{Syntax: "OCTET STRING"}},
+		{Name: "n"},
+		{Name: "type", Mib: MibInfo{Syntax: "INTEGER {ipv4(1), ipv6(2)}"}},
+	}
+	if values, err = decodeIndex(parts, "2.104.105.7.2"); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []interface{}{"hi", 7, "ipv6"}) {
+		t.Errorf("unexpected values: %v", values)
+	}
+	for _, suffix := range []string{"", "5.104.105", "2.104.105.7", "2.104.105.7.1.8"} {
+		if _, err := decodeIndex(parts, suffix); err == nil {
+			t.Errorf("expected error for index: %q", suffix)
+		}
+	}
+}
+
+func TestWalkTable(t *testing.T) {
+	a := agentsim.New()
+	for i, name := range []string{"eth0", "eth1"} {
+		n := strconv.Itoa(i + 1)
+		a.Set(".1.3.6.1.2.1.2.2.1.1."+n, gosnmp.Integer, i+1)
+		a.Set(".1.3.6.1.2.1.2.2.1.2."+n, gosnmp.OctetString, "port "+name)
+		a.Set(".1.3.6.1.2.1.2.2.1.8."+n, gosnmp.Integer, i+1)
+		a.Set(".1.3.6.1.2.1.2.2.1.10."+n, gosnmp.Counter32, 1000*(i+1))
+		a.Set(".1.3.6.1.2.1.31.1.1.1.1."+n, gosnmp.OctetString, name)
+	}
+	if err := a.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	p := Profile{Host: "127.0.0.1", Port: a.Port(), Version: "2c", Timeout: testTimeout}
+	table, err := WalkTable(p, "ifTable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.Name != "ifTable" || !reflect.DeepEqual(table.Index, []string{"ifIndex"}) {
+		t.Errorf("unexpected table info: %s %v", table.Name, table.Index)
+	}
+	if keys := table.Keys(); !reflect.DeepEqual(keys, []string{"1", "2"}) {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+	row := table.Rows["2"]
+	if row.Index["ifIndex"] != 2 {
+		t.Errorf("unexpected index: %v", row.Index)
+	}
+	for name, want := range map[string]interface{}{
+		"ifDescr":      "port eth1",
+		"ifOperStatus": "down",
+		"ifInOctets":   uint32(2000),
+		"ifName":       "eth1",
+	} {
+		if v := row.Columns[name]; v != want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", name, want, want, v, v)
+		}
+	}
+
+	if _, err := WalkTable(p, "sysName"); err == nil {
+		t.Error("expected error walking a scalar as a table")
+	}
+}
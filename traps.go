@@ -0,0 +1,192 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	sysUpTime          = ".1.3.6.1.2.1.1.3.0"
+	snmpTrapOID        = ".1.3.6.1.6.3.1.1.4.1.0"
+	snmpTrapEnterprise = ".1.3.6.1.6.3.1.1.4.3.0"
+	snmpTraps          = ".1.3.6.1.6.3.1.1.5"
+)
+
+// TrapListener receives SNMP traps and informs and sends each
+// varbind on to a Sender, tagged with the source host, the trap
+// and the enterprise that sent it
+type TrapListener struct {
+	Tags     map[string]string // any additional tags to associate
+	OIDTag   bool              // add varbind OID as a tag
+	listener *gosnmp.TrapListener
+	sender   Sender
+	logger   *log.Logger
+	p        Profile
+}
+
+// NewTrapListener returns a TrapListener that accepts traps using the
+// credentials in the Profile (the Host and Port are not used).
+// For v1/v2c a non-empty community is required to match.
+func NewTrapListener(p Profile, sender Sender, logger *log.Logger) (*TrapListener, error) {
+	if sender == nil {
+		sender, _ = DebugSender(nil, nil)
+	}
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	params, err := clientConfig(p)
+	if err != nil {
+		return nil, err
+	}
+	t := &TrapListener{
+		listener: gosnmp.NewTrapListener(),
+		sender:   sender,
+		logger:   logger,
+		p:        p,
+	}
+	t.listener.Params = params
+	t.listener.OnNewTrap = t.handler
+	return t, nil
+}
+
+// Listen binds to the UDP address (e.g., "0.0.0.0:162") and processes
+// traps until Close is called
+func (t *TrapListener) Listen(addr string) error {
+	return t.listener.Listen(addr)
+}
+
+// Listening returns a channel that is ready once the listener is bound
+func (t *TrapListener) Listening() <-chan bool {
+	return t.listener.Listening()
+}
+
+// Close stops the listener
+func (t *TrapListener) Close() {
+	t.listener.Close()
+}
+
+// oidName returns the symbolic name of the OID if it is known
+func oidName(oid string) string {
+	if !strings.HasPrefix(oid, ".") {
+		oid = "." + oid
+	}
+	sub, v, ok := rtree.Root().LongestPrefix([]byte(oid))
+	if !ok {
+		return oid
+	}
+	if len(sub) == len(oid) {
+		return v.(string)
+	}
+	return v.(string) + oid[len(sub):]
+}
+
+// trapOID returns the trap OID and enterprise of a v1 trap per RFC 3584
+func trapOID(packet *gosnmp.SnmpPacket) (string, string) {
+	enterprise := packet.Enterprise
+	if !strings.HasPrefix(enterprise, ".") {
+		enterprise = "." + enterprise
+	}
+	if packet.GenericTrap == 6 {
+		return fmt.Sprintf("%s.0.%d", enterprise, packet.SpecificTrap), enterprise
+	}
+	return fmt.Sprintf("%s.%d", snmpTraps, packet.GenericTrap+1), enterprise
+}
+
+// handler processes each trap received
+func (t *TrapListener) handler(packet *gosnmp.SnmpPacket, addr *net.UDPAddr) {
+	if packet.Version != gosnmp.Version3 && len(t.p.Community) > 0 && packet.Community != t.p.Community {
+		t.logger.Printf("trap from %s has invalid community\n", addr.IP)
+		return
+	}
+
+	now := time.Now()
+	ts := TimeStamp{Start: now, Stop: now}
+	var trap, enterprise string
+	var uptime interface{}
+	if packet.PDUType == gosnmp.Trap {
+		trap, enterprise = trapOID(packet)
+		uptime = packet.Timestamp
+	}
+
+	vars := make([]gosnmp.SnmpPDU, 0, len(packet.Variables))
+	for _, pdu := range packet.Variables {
+		oid := pdu.Name
+		if !strings.HasPrefix(oid, ".") {
+			oid = "." + oid
+		}
+		pdu.Name = oid
+		switch oid {
+		case sysUpTime:
+			uptime = pdu.Value
+		case snmpTrapOID:
+			if s, ok := pdu.Value.(string); ok {
+				trap = s
+			}
+		case snmpTrapEnterprise:
+			if s, ok := pdu.Value.(string); ok {
+				enterprise = s
+			}
+		default:
+			vars = append(vars, pdu)
+		}
+	}
+
+	tags := func() map[string]string {
+		tags := map[string]string{"host": addr.IP.String()}
+		if len(trap) > 0 {
+			tags["trap"] = oidName(trap)
+		}
+		if len(enterprise) > 0 {
+			tags["enterprise"] = oidName(enterprise)
+		}
+		if packet.PDUType == gosnmp.InformRequest {
+			tags["inform"] = "true"
+		}
+		for k, v := range t.Tags {
+			tags[k] = v
+		}
+		return tags
+	}
+
+	// a trap with no varbinds is still an event worth noting
+	if len(vars) == 0 {
+		if err := t.sender(oidName(trap), tags(), uptime, ts); err != nil {
+			t.logger.Println(errors.Wrap(err, "trap sender"))
+		}
+		return
+	}
+
+	for _, pdu := range vars {
+		name := pdu.Name
+		value := pdu.Value
+		sub, v, ok := rtree.Root().LongestPrefix([]byte(pdu.Name))
+		if ok {
+			if oInfo, ok := oidBase[string(sub)]; ok {
+				name = v.(string)
+				var err error
+				if value, err = oInfo.Fn(pdu); err != nil {
+					t.logger.Printf("bad trap name:%s error:%s\n", name, err)
+					continue
+				}
+			}
+		}
+		tags := tags()
+		if t.OIDTag {
+			tags["oid"] = pdu.Name
+		}
+		if err := t.sender(name, tags, value, ts); err != nil {
+			t.logger.Println(errors.Wrap(err, "trap sender"))
+		}
+	}
+}
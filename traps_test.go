@@ -0,0 +1,174 @@
+// Copyright 2016 Paul Stuart. All rights reserved.
+// Use of this source code is governed by a BSD-style license
+// that can be found in the LICENSE file.
+
+package snmputil
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+const (
+	testTrapPort       = 19162
+	testTrapOID        = ".1.3.6.1.4.1.99999.0.1"
+	testTrapVar        = ".1.3.6.1.4.1.99999.1.1.0"
+	testTrapEnterprise = ".1.3.6.1.4.1.99999"
+)
+
+type trapSample struct {
+	name  string
+	tags  map[string]string
+	value interface{}
+}
+
+// trapClient starts a TrapListener for the Profile on port and
+// returns the samples it receives and a client to send traps to it
+func trapClient(t *testing.T, p Profile, port int) (<-chan trapSample, *gosnmp.GoSNMP, func()) {
+	got := make(chan trapSample, 10)
+	sender := func(name string, tags map[string]string, value interface{}, ts TimeStamp) error {
+		got <- trapSample{name, tags, value}
+		return nil
+	}
+	l, err := NewTrapListener(p, sender, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := l.Listen(fmt.Sprintf("127.0.0.1:%d", port)); err != nil {
+			t.Error(err)
+		}
+	}()
+	<-l.Listening()
+
+	p.Host = "127.0.0.1"
+	p.Port = port
+	p.Timeout = testTimeout
+	client, err := clientConfig(p)
+	if err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	if err := client.Connect(); err != nil {
+		l.Close()
+		t.Fatal(err)
+	}
+	return got, client, func() {
+		client.Conn.Close()
+		l.Close()
+	}
+}
+
+// checkTrap checks the next sample is testTrapVar sent with the trap tags
+func checkTrap(t *testing.T, desc string, got <-chan trapSample, tags map[string]string) {
+	select {
+	case s := <-got:
+		if s.name != testTrapVar {
+			t.Errorf("%s: expected name %s but got %s", desc, testTrapVar, s.name)
+		}
+		if s.value != 42 {
+			t.Errorf("%s: expected value 42 but got %v", desc, s.value)
+		}
+		if s.tags["host"] != "127.0.0.1" {
+			t.Errorf("%s: unexpected host tag: %s", desc, s.tags["host"])
+		}
+		for k, v := range tags {
+			if s.tags[k] != v {
+				t.Errorf("%s: expected %s tag %q but got %q", desc, k, v, s.tags[k])
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s: no trap received", desc)
+	}
+}
+
+func TestTrapListener(t *testing.T) {
+	p := Profile{Version: "2c", Community: testCommunity}
+	got, client, done := trapClient(t, p, testTrapPort)
+	defer done()
+
+	trap := gosnmp.SnmpTrap{
+		Variables: []gosnmp.SnmpPDU{
+			{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: testTrapOID},
+			{Name: testTrapVar, Type: gosnmp.Integer, Value: 42},
+		},
+	}
+	for _, inform := range []bool{false, true} {
+		trap.IsInform = inform
+		// informs must be acknowledged, or this will time out
+		if _, err := client.SendTrap(trap); err != nil {
+			t.Fatal(err)
+		}
+		tags := map[string]string{"trap": testTrapOID}
+		if inform {
+			tags["inform"] = "true"
+		}
+		checkTrap(t, fmt.Sprintf("inform=%t", inform), got, tags)
+	}
+}
+
+func TestTrapV1(t *testing.T) {
+	p := Profile{Version: "1", Community: testCommunity}
+	got, client, done := trapClient(t, p, testTrapPort+1)
+	defer done()
+
+	// generic traps are mapped to the standard traps and specific
+	// traps to the enterprise, per RFC 3584
+	for _, test := range []struct {
+		generic, specific int
+		trap              string
+	}{
+		{0, 0, snmpTraps + ".1"}, // coldStart
+		{2, 0, snmpTraps + ".3"}, // linkDown
+		{6, 1, testTrapOID},
+	} {
+		trap := gosnmp.SnmpTrap{
+			Variables: []gosnmp.SnmpPDU{
+				{Name: testTrapVar, Type: gosnmp.Integer, Value: 42},
+			},
+			Enterprise:   testTrapEnterprise,
+			AgentAddress: "127.0.0.1",
+			GenericTrap:  test.generic,
+			SpecificTrap: test.specific,
+			Timestamp:    100,
+		}
+		if _, err := client.SendTrap(trap); err != nil {
+			t.Fatal(err)
+		}
+		tags := map[string]string{
+			"trap":       oidName(test.trap),
+			"enterprise": oidName(testTrapEnterprise),
+		}
+		checkTrap(t, fmt.Sprintf("generic %d specific %d", test.generic, test.specific), got, tags)
+	}
+}
+
+func TestTrapV3(t *testing.T) {
+	p := Profile{
+		Version:   "3",
+		SecLevel:  "AuthPriv",
+		AuthUser:  "user",
+		AuthPass:  "authpass",
+		AuthProto: "SHA",
+		PrivPass:  "privpass",
+		PrivProto: "AES",
+	}
+	got, client, done := trapClient(t, p, testTrapPort+2)
+	defer done()
+
+	// the sender of a trap is the authoritative engine
+	client.SecurityParameters.(*gosnmp.UsmSecurityParameters).AuthoritativeEngineID = "\x80\x00\x1f\x88\x04traptest"
+	trap := gosnmp.SnmpTrap{
+		Variables: []gosnmp.SnmpPDU{
+			{Name: snmpTrapOID, Type: gosnmp.ObjectIdentifier, Value: testTrapOID},
+			{Name: testTrapVar, Type: gosnmp.Integer, Value: 42},
+		},
+	}
+	if _, err := client.SendTrap(trap); err != nil {
+		t.Fatal(err)
+	}
+	checkTrap(t, "v3", got, map[string]string{"trap": testTrapOID})
+}